@@ -0,0 +1,57 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// actionTailLines is how many of the last non-empty lines of a response are searched for the recommendation
+const actionTailLines = 10
+
+// underscoredActionRe matches a __approve__/__request_changes__ marker anywhere in a line, the underscores
+// possibly escaped by the model
+var underscoredActionRe = regexp.MustCompile(`(?i)(?:\\?_){2}(approve|request_changes)(?:\\?_){2}`)
+
+// bareActionRe matches a line that is only the recommendation without its underscores, e.g. "**Approve**"
+// or "Recommendation: request changes"
+var bareActionRe = regexp.MustCompile(`(?i)^[\s*_\x60>#:-]*(?:(?:final\s+)?(?:recommendation|verdict|decision)[\s*_\x60]*:?[\s*_\x60]*)?(approve|request[ _]changes)[\s*_\x60.!]*$`)
+
+// parseAction finds the recommendation at the end of a response: "approve", "request_changes", or "" when
+// there is none. Only the last lines are searched, and a line holding both markers is the instructions
+// echoed back, not a recommendation. When the last lines recommend both, the safer request_changes wins.
+func parseAction(responseText string) string {
+	lines := strings.Split(strings.TrimSpace(responseText), "\n")
+	action := ""
+	seen := 0
+	for i := len(lines) - 1; i >= 0 && seen < actionTailLines; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		seen++
+
+		found := lineActions(line)
+		if len(found) != 1 {
+			continue
+		}
+		for candidate := range found {
+			if action != "" && action != candidate {
+				return "request_changes"
+			}
+			action = candidate
+		}
+	}
+	return action
+}
+
+// lineActions returns the distinct recommendations a line holds
+func lineActions(line string) map[string]bool {
+	found := make(map[string]bool)
+	for _, matches := range underscoredActionRe.FindAllStringSubmatch(line, -1) {
+		found[strings.ToLower(matches[1])] = true
+	}
+	if matches := bareActionRe.FindStringSubmatch(line); matches != nil {
+		found[strings.ReplaceAll(strings.ToLower(matches[1]), " ", "_")] = true
+	}
+	return found
+}
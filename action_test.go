@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAction(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{"underscored", "Looks good.\n\n__approve__", "approve"},
+		{"upper case", "Looks good.\n\n__APPROVE__", "approve"},
+		{"mixed case", "Needs work.\n\n__Request_Changes__", "request_changes"},
+		{"escaped underscores", "Looks good.\n\n\\_\\_approve\\_\\_", "approve"},
+		{"bold marker", "Looks good.\n\n**__approve__**", "approve"},
+		{"bold bare word", "Looks good.\n\n**APPROVE**", "approve"},
+		{"labelled", "Needs work.\n\nRecommendation: request changes", "request_changes"},
+		{"final verdict", "Needs work.\n\n**Final verdict:** Request_Changes.", "request_changes"},
+		{"echoed instructions", "Finish with __approve__ or __request_changes__.\n\nLooks good.\n\n__approve__", "approve"},
+		{"instructions above the tail", "Use __request_changes__ when something is broken.\n" + strings.Repeat("Fine.\n", actionTailLines) + "__approve__", "approve"},
+		{"conflicting", "__approve__\n\n__request_changes__", "request_changes"},
+		{"word in a sentence", "I would approve this once the tests pass.", ""},
+		{"none", "Looks good.", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAction(tt.response); got != tt.want {
+				t.Errorf("parseAction(%q) = %q, want %q", tt.response, got, tt.want)
+			}
+		})
+	}
+}
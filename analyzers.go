@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// conflictMarkerRe matches the start and the end of a merge conflict left in a file. The "=======" separator
+// alone is also a markdown heading underline, so it isn't flagged.
+var conflictMarkerRe = regexp.MustCompile(`^(<{7}|>{7})(\s|$)`)
+
+// debugLeftoverRe matches the debugging statements that shouldn't be merged
+var debugLeftoverRe = regexp.MustCompile(`(?:^|[^\w.$])(console\.(?:log|debug|trace)\(|debugger\s*;?\s*$|pdb\.set_trace\(\)|breakpoint\(\)|binding\.pry\b|byebug\b|var_dump\(|dbg!\()`)
+
+// secretRes match credentials committed in plain text, by the kind of secret they are
+var secretRes = []struct {
+	Kind string
+	Re   *regexp.Regexp
+}{
+	{"a private key", regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP )?PRIVATE KEY`)},
+	{"an AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"a GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`)},
+	{"a Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"a hardcoded credential", regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret|password|passwd|access[_-]?token|auth[_-]?token)\w*["']?\s*(?::=|[:=])\s*["'][^"'\s]{12,}["']`)},
+}
+
+// addedLineComments returns a comment on each added line that flag returns a body for, "" leaves the line alone
+func addedLineComments(files []*github.CommitFile, flag func(filename, text string) string) []*github.DraftReviewComment {
+	var comments []*github.DraftReviewComment
+	for _, file := range files {
+		if file.Patch == nil {
+			continue
+		}
+		content := commentableLines(file.GetPatch())
+		for _, line := range addedLines(file.GetPatch()) {
+			body := flag(file.GetFilename(), content[line])
+			if body == "" {
+				continue
+			}
+			comments = append(comments, &github.DraftReviewComment{
+				Path: github.String(file.GetFilename()),
+				Line: github.Int(line),
+				Side: github.String("RIGHT"),
+				Body: github.String(body),
+			})
+		}
+	}
+	return comments
+}
+
+// conflictMarkerComments flags the merge conflict markers added by the PR
+func conflictMarkerComments(files []*github.CommitFile) []*github.DraftReviewComment {
+	return addedLineComments(files, func(filename, text string) string {
+		if !conflictMarkerRe.MatchString(text) {
+			return ""
+		}
+		return "[blocker] This is a leftover merge conflict marker, resolve the conflict."
+	})
+}
+
+// debugLeftoverComments flags the debugging statements added to code files, tests may keep theirs
+func debugLeftoverComments(files []*github.CommitFile) []*github.DraftReviewComment {
+	return addedLineComments(files, func(filename, text string) string {
+		if !isCodeFile(filename) || isTestFile(filename) {
+			return ""
+		}
+		matches := debugLeftoverRe.FindStringSubmatch(text)
+		if matches == nil {
+			return ""
+		}
+		return fmt.Sprintf("[minor] `%s` looks like a debugging leftover, remove it before merging.", strings.TrimSpace(matches[1]))
+	})
+}
+
+// secretComments flags the added lines that look like credentials. The secret itself isn't quoted.
+func secretComments(files []*github.CommitFile) []*github.DraftReviewComment {
+	return addedLineComments(files, func(filename, text string) string {
+		for _, secret := range secretRes {
+			if secret.Re.MatchString(text) {
+				return fmt.Sprintf("[blocker] This line looks like it adds %s. Remove it, revoke it, and load it from the environment or a secret store instead.", secret.Kind)
+			}
+		}
+		return ""
+	})
+}
+
+// missingTestsNote returns a note when the PR adds code without changing any test, or ""
+func missingTestsNote(files []*github.CommitFile) string {
+	var changed []string
+	for _, file := range files {
+		if isTestFile(file.GetFilename()) {
+			return ""
+		}
+		if isCodeFile(file.GetFilename()) && len(addedLines(file.GetPatch())) > 0 {
+			changed = append(changed, file.GetFilename())
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("### Missing Tests\n\nThe PR adds code to %d files without changing any test:\n- `%s`", len(changed), strings.Join(changed, "`\n- `"))
+}
+
+// isCodeFile reports whether the file is in one of the programming languages the analyzers know
+func isCodeFile(filename string) bool {
+	_, ok := commentPrefixes[strings.TrimPrefix(strings.ToLower(path.Ext(filename)), ".")]
+	return ok
+}
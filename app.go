@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v55/github"
+)
+
+// githubApp holds the credentials of a GitHub App installation the tool authenticates as
+type githubApp struct {
+	ID             int64
+	InstallationID int64
+	// KeyPath is the path of the app's PEM private key
+	KeyPath string
+}
+
+// githubAppFromEnv reads the app credentials from GITHUB_APP_ID, GITHUB_APP_INSTALLATION_ID and
+// GITHUB_APP_PRIVATE_KEY_PATH. It returns nil when none is set, to use GITHUB_TOKEN instead.
+func githubAppFromEnv() (*githubApp, error) {
+	id, installationID, keyPath := os.Getenv("GITHUB_APP_ID"), os.Getenv("GITHUB_APP_INSTALLATION_ID"), os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH")
+	if id == "" && installationID == "" && keyPath == "" {
+		return nil, nil
+	}
+	if id == "" || installationID == "" || keyPath == "" {
+		return nil, fmt.Errorf("GitHub App authentication needs GITHUB_APP_ID, GITHUB_APP_INSTALLATION_ID and GITHUB_APP_PRIVATE_KEY_PATH")
+	}
+
+	app := &githubApp{KeyPath: keyPath}
+	var err error
+	app.ID, err = strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_APP_ID %q: %w", id, err)
+	}
+	app.InstallationID, err = strconv.ParseInt(installationID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_APP_INSTALLATION_ID %q: %w", installationID, err)
+	}
+	return app, nil
+}
+
+// newGitHubAppClient returns a client authenticated with the app installation's tokens, renewed when
+// they expire, and the login of the app's bot user the reviews are posted as
+func newGitHubAppClient(ctx context.Context, app *githubApp, baseURL string) (*github.Client, string, error) {
+	installation, err := ghinstallation.NewKeyFromFile(http.DefaultTransport, app.ID, app.InstallationID, app.KeyPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading the app's private key: %w", err)
+	}
+	jwt, err := ghinstallation.NewAppsTransportKeyFromFile(http.DefaultTransport, app.ID, app.KeyPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading the app's private key: %w", err)
+	}
+
+	client, err := newGitHubClient(&http.Client{Transport: installation}, baseURL)
+	if err != nil {
+		return nil, "", err
+	}
+	appClient, err := newGitHubClient(&http.Client{Transport: jwt}, baseURL)
+	if err != nil {
+		return nil, "", err
+	}
+	// the tokens come from the same API as everything else, e.g. a GitHub Enterprise Server
+	apiURL := strings.TrimSuffix(client.BaseURL.String(), "/")
+	installation.BaseURL, jwt.BaseURL = apiURL, apiURL
+
+	// installation tokens can't read /user, the bot is named after the app
+	self, _, err := appClient.Apps.Get(ctx, "")
+	if err != nil {
+		return nil, "", fmt.Errorf("error fetching the GitHub App: %w", err)
+	}
+	return client, self.GetSlug() + "[bot]", nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// askPullRequest answers a free-form question about the PR's changes. Nothing is posted.
+func askPullRequest(ctx context.Context, client *github.Client, opts runOptions, owner, repo string, prNumber int, question string) (string, error) {
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, prNumber)
+	if err != nil {
+		return "", fmt.Errorf("error fetching PR details: %w", err)
+	}
+
+	files, err := listPullRequestFiles(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return "", fmt.Errorf("error fetching PR files: %w", err)
+	}
+
+	simplifiedPatch, combinedChanges, _ := diffContext(files)
+	prompt := fmt.Sprintf(`
+	PR %s by %s: %s
+
+	The following files were changed:
+	%s
+
+	advanced diff:
+	%s
+
+	Answer the following question about this PR concisely, in markdown, based on the changes above. Point to the relevant files and lines. If the changes don't contain enough information to answer, say so.
+
+	Question: %s
+	`, pr.GetTitle(), pr.GetUser().GetLogin(), pr.GetBody(), simplifiedPatch, combinedChanges, question)
+
+	resp, err := createCompletion(ctx, opts.Completion, prompt)
+	if err != nil {
+		return "", fmt.Errorf("error asking the model: %w", err)
+	}
+	return resp.Choices[0].Message.Content, nil
+}
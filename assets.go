@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// assetExtensions are the binary assets that can't be reviewed line by line, by kind
+var assetExtensions = map[string]string{
+	".png": "image", ".jpg": "image", ".jpeg": "image", ".gif": "image", ".webp": "image",
+	".svg": "image", ".ico": "image", ".bmp": "image", ".avif": "image",
+	".woff": "font", ".woff2": "font", ".ttf": "font", ".otf": "font", ".eot": "font",
+	".mp3": "media", ".mp4": "media", ".wav": "media", ".webm": "media", ".ogg": "media",
+	".pdf": "document",
+}
+
+// assetKind returns the kind of asset a file is, or "" when it isn't an asset
+func assetKind(filename string) string {
+	return assetExtensions[strings.ToLower(path.Ext(filename))]
+}
+
+// splitAssets separates the asset files, which are never sent to the model, from the others
+func splitAssets(files []*github.CommitFile) (others, assets []*github.CommitFile) {
+	for _, file := range files {
+		if assetKind(file.GetFilename()) != "" {
+			assets = append(assets, file)
+		} else {
+			others = append(others, file)
+		}
+	}
+	return others, assets
+}
+
+// renderAssetChanges lists the changed assets with their size at the head commit and, with links,
+// the raw URL of the added images so reviewers can look at them
+func renderAssetChanges(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest, assets []*github.CommitFile, links bool) string {
+	lines := []string{"### Asset Changes", "", "These assets can't be reviewed line by line and weren't sent to the model:"}
+	for _, file := range assets {
+		status := file.GetStatus()
+		if status == "removed" {
+			lines = append(lines, fmt.Sprintf("- `%s` (%s) removed", file.GetFilename(), assetKind(file.GetFilename())))
+			continue
+		}
+
+		line := fmt.Sprintf("- `%s` (%s) %s", file.GetFilename(), assetKind(file.GetFilename()), status)
+		content, _, _, err := client.Repositories.GetContents(ctx, owner, repo, file.GetFilename(), &github.RepositoryContentGetOptions{Ref: pr.GetHead().GetSHA()})
+		if err != nil {
+			logf(slog.LevelError, "Error fetching the size of %s: %v\n", file.GetFilename(), err)
+		} else if content != nil {
+			line += ", " + formatSize(content.GetSize())
+		}
+		if links && status == "added" && assetKind(file.GetFilename()) == "image" && file.GetRawURL() != "" {
+			line += fmt.Sprintf(" ([view](%s))", file.GetRawURL())
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatSize renders a size in bytes for humans
+func formatSize(size int) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
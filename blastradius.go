@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// blastRadius is the number of other files of the repository referencing a changed file
+type blastRadius struct {
+	File       string
+	Dependents int
+}
+
+// referenceTerm returns what other files use to refer to the changed file: the package directory
+// for Go files (imports name packages, not files) and the file name without extension otherwise.
+// It returns "" when the file can't be referenced by name.
+func referenceTerm(filename string) string {
+	if strings.HasSuffix(filename, ".go") {
+		dir := path.Dir(filename)
+		if dir == "." {
+			// the root package is usually main, which can't be imported
+			return ""
+		}
+		return dir
+	}
+	base := path.Base(filename)
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	// very short names match too much unrelated code to be meaningful
+	if len(stem) < 4 || strings.HasPrefix(stem, ".") {
+		return ""
+	}
+	return stem
+}
+
+// measureBlastRadius counts, with GitHub code search, how many other files reference each changed
+// source file and returns those referenced by at least threshold files.
+// Code search is heavily rate limited, so the search stops at the first rate limit error.
+func measureBlastRadius(ctx context.Context, client *github.Client, owner, repo string, files []*github.CommitFile, threshold int) ([]blastRadius, error) {
+	var risky []blastRadius
+	for _, file := range files {
+		if file.GetStatus() == "removed" || isTestFile(file.GetFilename()) {
+			continue
+		}
+		term := referenceTerm(file.GetFilename())
+		if term == "" {
+			continue
+		}
+
+		query := fmt.Sprintf("%q repo:%s/%s", term, owner, repo)
+		result, _, err := client.Search.Code(ctx, query, &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 100}})
+		if err != nil {
+			var rateErr *github.RateLimitError
+			var abuseErr *github.AbuseRateLimitError
+			if errors.As(err, &rateErr) || errors.As(err, &abuseErr) {
+				logf(slog.LevelWarn, "Code search rate limited, blast radius measured for part of the files only: %v\n", err)
+				break
+			}
+			return nil, fmt.Errorf("error searching references to %s: %w", file.GetFilename(), err)
+		}
+
+		// the file itself, and files of the same Go package, mention the term too
+		dependents := result.GetTotal()
+		for _, hit := range result.CodeResults {
+			if hit.GetPath() == file.GetFilename() || (strings.HasSuffix(file.GetFilename(), ".go") && path.Dir(hit.GetPath()) == term) {
+				dependents--
+			}
+		}
+		logf(slog.LevelDebug, "Blast radius of %s: %d referencing files\n", file.GetFilename(), dependents)
+
+		if dependents >= threshold {
+			risky = append(risky, blastRadius{File: file.GetFilename(), Dependents: dependents})
+		}
+	}
+	return risky, nil
+}
+
+// renderBlastRadius renders the warning added to the review summary
+func renderBlastRadius(risky []blastRadius) string {
+	lines := []string{"### High Blast Radius", "", "These changed files are heavily depended upon, changes to them can break code well beyond this diff:"}
+	for _, r := range risky {
+		lines = append(lines, fmt.Sprintf("- ⚠️ `%s` is referenced by %d other files", r.File, r.Dependents))
+	}
+	return strings.Join(lines, "\n")
+}
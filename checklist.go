@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// checklistResult is the model's verdict for a single checklist item
+type checklistResult struct {
+	Item   string
+	Status string // "pass", "fail", "na" or "missing" when the model skipped it
+	Note   string
+}
+
+// loadChecklist reads checklist items from a file, one item per line.
+// Blank lines and lines starting with # are ignored.
+func loadChecklist(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading checklist file: %w", err)
+	}
+
+	var items []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimPrefix(line, "- ")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		items = append(items, line)
+	}
+	return items, nil
+}
+
+// checklistPrompt builds the prompt section asking the model to address every checklist item
+func checklistPrompt(items []string) string {
+	if len(items) == 0 {
+		return ""
+	}
+
+	var quoted []string
+	for _, item := range items {
+		quoted = append(quoted, fmt.Sprintf("- %q", item))
+	}
+
+	return fmt.Sprintf(`Review Checklist:
+
+Before the "### Specific Comments:" section, add a "### Checklist:" section that addresses every one of the following items. For each item state pass, fail or na (not applicable), followed by a short note. Use the exact item text in double quotes.
+
+Items:
+%s
+
+Format:
+- "item": pass: "note"
+
+Example:
+### Checklist:
+- "Error handling": fail: "the error from os.Open is ignored"
+- "Tests": na: "documentation only change"
+`, strings.Join(quoted, "\n"))
+}
+
+// checklistAnswerRe matches an answer of the checklist section, e.g. - "Tests": fail: "no test added"
+var checklistAnswerRe = regexp.MustCompile(`(?i)-\s*"([^"]+)":\s*(pass|fail|n/?a)\b(?::\s*"([^"]*)")?`)
+
+// checklistSectionRe matches the "### Checklist:" section up to the next header
+var checklistSectionRe = regexp.MustCompile(`(?s)#{1,4}\s*\**Checklist\**:?.*?(#{1,4}\s|$)`)
+
+// parseChecklist matches the model's checklist answers against the configured items.
+// Items the model did not address are returned with the "missing" status.
+func parseChecklist(responseText string, items []string) []checklistResult {
+	answers := make(map[string]checklistResult)
+	for _, matches := range checklistAnswerRe.FindAllStringSubmatch(responseText, -1) {
+		status := strings.ToLower(strings.ReplaceAll(matches[2], "/", ""))
+		answers[strings.ToLower(strings.TrimSpace(matches[1]))] = checklistResult{
+			Status: status,
+			Note:   matches[3],
+		}
+	}
+
+	var results []checklistResult
+	for _, item := range items {
+		result, ok := answers[strings.ToLower(item)]
+		if !ok {
+			logf(slog.LevelWarn, "Checklist item %q was not addressed by the model", item)
+			result.Status = "missing"
+		}
+		result.Item = item
+		results = append(results, result)
+	}
+	return results
+}
+
+// removeChecklistSection strips the raw "### Checklist:" section produced by the model
+func removeChecklistSection(input string) string {
+	return checklistSectionRe.ReplaceAllString(input, "$1")
+}
+
+// renderChecklist renders checklist results as a markdown task list
+func renderChecklist(results []checklistResult) string {
+	if len(results) == 0 {
+		return ""
+	}
+
+	var lines []string
+	lines = append(lines, "### Checklist")
+	for _, result := range results {
+		var line string
+		switch result.Status {
+		case "pass":
+			line = fmt.Sprintf("- [x] %s: **pass**", result.Item)
+		case "na":
+			line = fmt.Sprintf("- [x] %s: **n/a**", result.Item)
+		case "fail":
+			line = fmt.Sprintf("- [ ] %s: **fail**", result.Item)
+		default:
+			line = fmt.Sprintf("- [ ] %s: ⚠️ **not addressed**", result.Item)
+		}
+		if result.Note != "" {
+			line += " - " + result.Note
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
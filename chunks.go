@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// responseTokens is the part of the context window left for the model's response
+const responseTokens = 4096
+
+// tokenBudget returns the maximum size in tokens of a review prompt: maxTokens when set, otherwise
+// the model's context window less room for the response. 0 means no known limit.
+func tokenBudget(model string, maxTokens int) int {
+	if maxTokens > 0 {
+		return maxTokens
+	}
+	if window := contextWindow(model); window > responseTokens {
+		return window - responseTokens
+	}
+	return 0
+}
+
+// batchFiles splits the files into batches whose changes fit in budget tokens, keeping their order.
+// A file larger than the budget gets a batch of its own.
+func batchFiles(ctx context.Context, files []*github.CommitFile, budget int, model string) [][]*github.CommitFile {
+	var batches [][]*github.CommitFile
+	var batch []*github.CommitFile
+	size := 0
+	for _, file := range files {
+		simplified, combined, _ := diffContext([]*github.CommitFile{file})
+		tokens := countTokens(ctx, model, simplified) + countTokens(ctx, model, combined)
+		if tokens > budget {
+			logf(slog.LevelWarn, "The changes of %s alone exceed the token budget (%d > %d tokens)\n", file.GetFilename(), tokens, budget)
+		}
+		if len(batch) > 0 && size+tokens > budget {
+			batches = append(batches, batch)
+			batch, size = nil, 0
+		}
+		batch = append(batch, file)
+		size += tokens
+	}
+	if len(batch) > 0 || len(batches) == 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// mergeBatchReviews combines the reviews of the batches of a PR. Changes are requested when any
+// batch requests them, and the PR is approved only when no batch does.
+func mergeBatchReviews(parts []*generatedReview, batches [][]*github.CommitFile) *generatedReview {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	merged := &generatedReview{Model: parts[0].Model, Fingerprint: parts[0].Fingerprint, Action: "comment"}
+	bodies := []string{fmt.Sprintf("> This PR is too large for a single request, it was reviewed in %d parts.", len(parts))}
+	for i, part := range parts {
+		var names []string
+		for _, file := range batches[i] {
+			names = append(names, "`"+file.GetFilename()+"`")
+		}
+		bodies = append(bodies, fmt.Sprintf("## Part %d of %d\n\nFiles: %s\n\n%s", i+1, len(parts), strings.Join(names, ", "), part.Review))
+
+		merged.Comments = append(merged.Comments, part.Comments...)
+		merged.Usage.PromptTokens += part.Usage.PromptTokens
+		merged.Usage.CompletionTokens += part.Usage.CompletionTokens
+		merged.Usage.TotalTokens += part.Usage.TotalTokens
+		switch {
+		case part.Action == "request_changes":
+			merged.Action = "request_changes"
+		case part.Action == "approve" && merged.Action == "comment":
+			merged.Action = "approve"
+		}
+	}
+	merged.Review = strings.Join(bodies, "\n\n")
+	return merged
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// commentPrefixes maps the file extensions scanned for commented-out code to their line comment prefix
+var commentPrefixes = map[string]string{
+	"go": "//", "js": "//", "jsx": "//", "ts": "//", "tsx": "//", "java": "//", "kt": "//", "scala": "//",
+	"swift": "//", "c": "//", "h": "//", "cc": "//", "cpp": "//", "hpp": "//", "cs": "//", "rs": "//",
+	"php": "//", "dart": "//",
+	"py": "#", "rb": "#", "sh": "#", "bash": "#", "pl": "#", "r": "#",
+	"sql": "--", "lua": "--", "hs": "--",
+}
+
+// codeLineRes match the content of a comment that looks like disabled code rather than prose
+var codeLineRes = []*regexp.Regexp{
+	// statements and blocks
+	regexp.MustCompile(`[;{}]\s*$`),
+	regexp.MustCompile(`^[})\]]`),
+	// calls, e.g. fmt.Println(x)
+	regexp.MustCompile(`^[\w.]+\(.*\)[,;]?$`),
+	// assignments, e.g. x := 1, self.y = z
+	regexp.MustCompile(`^[\w.\[\]]+\s*(:=|\+=|-=|=)\s*[^=\s]`),
+	regexp.MustCompile(`^(return|import|package|func|def|var|let|const|class|from \S+ import)\b.*[\w)\]}"':]$`),
+	// Python blocks, e.g. if x > 0:
+	regexp.MustCompile(`^(if|elif|else|for|while|try|except|with|def|class)\b.*:$`),
+}
+
+// isCodeLine reports whether the text of a comment looks like a line of code
+func isCodeLine(text string) bool {
+	for _, re := range codeLineRes {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCommentedCodeLangs parses the -commented-code-langs list of extensions, empty scans every known language
+func parseCommentedCodeLangs(value string) (map[string]string, error) {
+	langs := splitList(value)
+	if len(langs) == 0 {
+		return commentPrefixes, nil
+	}
+	prefixes := make(map[string]string)
+	for _, lang := range langs {
+		lang = strings.TrimPrefix(strings.ToLower(lang), ".")
+		prefix, ok := commentPrefixes[lang]
+		if !ok {
+			var known []string
+			for ext := range commentPrefixes {
+				known = append(known, ext)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unsupported language %q, expected one of %s", lang, strings.Join(known, ", "))
+		}
+		prefixes[lang] = prefix
+	}
+	return prefixes, nil
+}
+
+// commentedCodeComments flags the runs of added comment lines holding at least threshold lines of
+// code as minor comments, without asking the model, so the pattern is caught every time
+func commentedCodeComments(files []*github.CommitFile, threshold int, prefixes map[string]string) []*github.DraftReviewComment {
+	var comments []*github.DraftReviewComment
+	for _, file := range files {
+		prefix := prefixes[strings.TrimPrefix(strings.ToLower(path.Ext(file.GetFilename())), ".")]
+		if prefix == "" || file.Patch == nil {
+			continue
+		}
+		content := commentableLines(file.GetPatch())
+
+		// a run is consecutive added comment lines, blank comment lines included
+		first, last, code := 0, 0, 0
+		flush := func() {
+			if code >= threshold {
+				comment := &github.DraftReviewComment{
+					Path: github.String(file.GetFilename()),
+					Line: github.Int(last),
+					Side: github.String("RIGHT"),
+					Body: github.String(fmt.Sprintf("[minor] This adds %d lines of commented-out code. Remove them, version control keeps the history, or explain why they're kept.", code)),
+				}
+				if first != last {
+					comment.StartLine, comment.StartSide = github.Int(first), github.String("RIGHT")
+				}
+				comments = append(comments, comment)
+			}
+			first, last, code = 0, 0, 0
+		}
+		previous := 0
+		for _, line := range addedLines(file.GetPatch()) {
+			text, isComment := strings.CutPrefix(strings.TrimSpace(content[line]), prefix)
+			if !isComment || line != previous+1 {
+				flush()
+			}
+			previous = line
+			if !isComment {
+				continue
+			}
+			text = strings.TrimSpace(text)
+			if isCodeLine(text) {
+				if first == 0 {
+					first = line
+				}
+				last = line
+				code++
+			}
+		}
+		flush()
+	}
+	return comments
+}
+
+// mergeCommentedCode adds the commented-out code comments to the model's, except those overlapping
+// a comment the model already made on the same lines
+func mergeCommentedCode(comments, found []*github.DraftReviewComment) []*github.DraftReviewComment {
+	var added []*github.DraftReviewComment
+	for _, candidate := range found {
+		duplicate := false
+		for _, comment := range comments {
+			if comment.GetPath() != candidate.GetPath() || comment.GetSide() == "LEFT" {
+				continue
+			}
+			start := comment.GetLine()
+			if comment.StartLine != nil {
+				start = comment.GetStartLine()
+			}
+			candidateStart := candidate.GetLine()
+			if candidate.StartLine != nil {
+				candidateStart = candidate.GetStartLine()
+			}
+			if start <= candidate.GetLine() && comment.GetLine() >= candidateStart {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			added = append(added, candidate)
+		}
+	}
+	return mergeComments(comments, added)
+}
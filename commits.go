@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// maxCommitPatchLength caps how much of a commit's diff is sent when summarizing it
+const maxCommitPatchLength = 8000
+
+// listPullRequestCommits returns every commit of a PR, oldest first
+func listPullRequestCommits(ctx context.Context, client *github.Client, owner, repo string, prNumber int) ([]*github.RepositoryCommit, error) {
+	var commits []*github.RepositoryCommit
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		var page []*github.RepositoryCommit
+		var resp *github.Response
+		err := withRateLimitRetry(ctx, func() (err error) {
+			page, resp, err = client.PullRequests.ListCommits(ctx, owner, repo, prNumber, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return commits, nil
+}
+
+// summarizeCommits asks the model for a one-line summary of each commit of the PR and
+// renders them as a markdown section
+func summarizeCommits(ctx context.Context, client *github.Client, completion completionOptions, owner, repo string, prNumber int) (string, error) {
+	commits, err := listPullRequestCommits(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return "", fmt.Errorf("error fetching PR commits: %w", err)
+	}
+
+	lines := []string{"### Commits"}
+	for _, commit := range commits {
+		sha := commit.GetSHA()
+		short := sha
+		if len(short) > 7 {
+			short = short[:7]
+		}
+
+		// ListCommits doesn't include the changes, fetch them per commit
+		full, _, err := client.Repositories.GetCommit(ctx, owner, repo, sha, &github.ListOptions{})
+		if err != nil {
+			return "", fmt.Errorf("error fetching commit %s: %w", short, err)
+		}
+
+		patch := simplifyPatch(full.Files)
+		if len(patch) > maxCommitPatchLength {
+			patch = patch[:maxCommitPatchLength] + "\n[diff truncated]"
+		}
+
+		prompt := fmt.Sprintf(`
+	Summarize what the following commit does in a single short sentence, without any preamble or formatting.
+
+	Commit message:
+	%s
+
+	Changes:
+	%s
+	`, commit.GetCommit().GetMessage(), patch)
+
+		resp, err := createCompletion(ctx, completion, prompt)
+		if err != nil {
+			return "", fmt.Errorf("error summarizing commit %s: %w", short, err)
+		}
+
+		summary := strings.Join(strings.Fields(resp.Choices[0].Message.Content), " ")
+		logf(slog.LevelDebug, "Commit %s: %s\n", short, summary)
+		lines = append(lines, fmt.Sprintf("- `%s` %s", short, summary))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// defaultCommitSpec is the commit message convention used unless -commit-spec names another one
+const defaultCommitSpec = `Conventional Commits 1.0.0: the subject is "<type>[optional scope][!]: <description>" where type is one of feat, fix, docs, style, refactor, perf, test, build, ci, chore or revert; the description is short, imperative and lowercase without a trailing period; an optional body is separated from the subject by a blank line; breaking changes are marked with "!" or a "BREAKING CHANGE:" footer.`
+
+// reviewCommitMessages asks the model to check every commit message of the PR against the spec and
+// renders the feedback as a markdown section
+func reviewCommitMessages(ctx context.Context, client *github.Client, completion completionOptions, owner, repo string, prNumber int, spec string) (string, error) {
+	commits, err := listPullRequestCommits(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return "", fmt.Errorf("error fetching PR commits: %w", err)
+	}
+
+	var messages []string
+	for _, commit := range commits {
+		short := commit.GetSHA()
+		if len(short) > 7 {
+			short = short[:7]
+		}
+		messages = append(messages, fmt.Sprintf("Commit %s:\n%s", short, commit.GetCommit().GetMessage()))
+	}
+
+	prompt := fmt.Sprintf(`
+	Check the following commit messages against this convention:
+	%s
+
+	%s
+
+	For each commit message that doesn't follow the convention, write one markdown list item: the short commit hash in backticks, what is wrong and a corrected subject line. Don't list the messages that follow the convention. If all of them do, answer exactly "All commit messages follow the convention."
+	`, spec, strings.Join(messages, "\n\n"))
+
+	resp, err := createCompletion(ctx, completion, prompt)
+	if err != nil {
+		return "", fmt.Errorf("error reviewing commit messages: %w", err)
+	}
+
+	return "### Commit Messages\n\n" + strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+// commitsPrompt renders the messages of the most recent commits of the PR, so the model can judge whether
+// the changes match the author's stated intent
+func commitsPrompt(commits []*github.RepositoryCommit, limit int) string {
+	if len(commits) == 0 || limit <= 0 {
+		return ""
+	}
+
+	header := "Commit Messages:"
+	if len(commits) > limit {
+		header = fmt.Sprintf("Commit Messages (the %d most recent of %d):", limit, len(commits))
+		commits = commits[len(commits)-limit:]
+	}
+
+	var messages []string
+	for _, commit := range commits {
+		short := commit.GetSHA()
+		if len(short) > 7 {
+			short = short[:7]
+		}
+		messages = append(messages, fmt.Sprintf("Commit %s:\n%s", short, strings.TrimSpace(commit.GetCommit().GetMessage())))
+	}
+	return header + "\n\n" + strings.Join(messages, "\n\n") + "\n"
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigPath is the repo-local config file read when -config isn't given
+const defaultConfigPath = ".gh-pr-reviewer.yaml"
+
+// fileConfig is the content of the YAML config file. Flags given on the command line override it.
+type fileConfig struct {
+	Owner string `yaml:"owner"`
+	Repo  string `yaml:"repo"`
+	Model string `yaml:"model"`
+	Dry   *bool  `yaml:"dry"`
+	// Ignore lists globs of files left out of the review
+	Ignore []string `yaml:"ignore"`
+	// SeverityEvents maps severities to request_changes or comment, like -severity-events
+	SeverityEvents map[string]string `yaml:"severity_events"`
+	// ApprovalPolicy lists the conditions under which the tool never approves, like -approval-policy
+	ApprovalPolicy *approvalPolicy `yaml:"approval_policy"`
+	// Repos maps owner/repo to the settings overriding the ones above for that repo
+	Repos map[string]repoOverride `yaml:"repos"`
+}
+
+// loadConfig reads the YAML config file. A missing file is only an error when required,
+// i.e. when its path was given explicitly. Unknown keys are rejected.
+func loadConfig(path string, required bool) (*fileConfig, error) {
+	config := &fileConfig{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	err = decoder.Decode(config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		// yaml.v3 names the offending key, e.g. "line 3: field foo not found in type main.fileConfig"
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	for _, pattern := range config.Ignore {
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("invalid glob %q in the ignore list of %s", pattern, path)
+		}
+	}
+	if config.ApprovalPolicy != nil {
+		for _, condition := range config.ApprovalPolicy.Conditions {
+			for _, pattern := range condition.Paths {
+				if !doublestar.ValidatePattern(pattern) {
+					return nil, fmt.Errorf("invalid glob %q in approval condition %q of %s", pattern, condition.Name, path)
+				}
+			}
+		}
+	}
+	if err := validateRepoOverrides(config.Repos, path); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// applyConfig sets the flags that weren't given on the command line from the config file
+func applyConfig(config *fileConfig) error {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	values := map[string]string{
+		"owner": config.Owner,
+		"repo":  config.Repo,
+		"model": config.Model,
+	}
+	if config.Dry != nil {
+		values["dry"] = strconv.FormatBool(*config.Dry)
+	}
+	if len(config.SeverityEvents) > 0 {
+		values["severity-events"] = severityEventsValue(config.SeverityEvents)
+	}
+
+	for name, value := range values {
+		if value == "" || explicit[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s in config file: %w", name, err)
+		}
+	}
+	return nil
+}
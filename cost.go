@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// modelPrice is the price in USD per million prompt and completion tokens
+type modelPrice struct {
+	Prompt     float64
+	Completion float64
+}
+
+// modelPrices lists the known model prices, matched by the longest model name prefix
+var modelPrices = map[string]modelPrice{
+	"gpt-4o-mini":       {Prompt: 0.15, Completion: 0.60},
+	"gpt-4o":            {Prompt: 2.50, Completion: 10.00},
+	"gpt-4-turbo":       {Prompt: 10.00, Completion: 30.00},
+	"gpt-4":             {Prompt: 30.00, Completion: 60.00},
+	"gpt-3.5-turbo":     {Prompt: 0.50, Completion: 1.50},
+	"claude-3-5-sonnet": {Prompt: 3.00, Completion: 15.00},
+	"claude-3-5-haiku":  {Prompt: 0.80, Completion: 4.00},
+	"claude-3-opus":     {Prompt: 15.00, Completion: 75.00},
+}
+
+// estimateCost returns the cost in USD of a completion, or 0 for models without a known price
+func estimateCost(model string, usage openai.Usage) float64 {
+	var price modelPrice
+	matched := ""
+	for name, p := range modelPrices {
+		if strings.HasPrefix(model, name) && len(name) > len(matched) {
+			matched, price = name, p
+		}
+	}
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6
+}
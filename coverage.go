@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// coverageReport maps a file path (as written in the report) to its line hit counts
+type coverageReport map[string]map[int]bool
+
+// loadCoverage reads a Go cover profile or an lcov tracefile and returns which lines are covered
+func loadCoverage(path string) (coverageReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading coverage file: %w", err)
+	}
+
+	content := string(data)
+	if strings.HasPrefix(strings.TrimSpace(content), "mode:") {
+		return parseGoCoverProfile(content), nil
+	}
+	return parseLcov(content), nil
+}
+
+// parseGoCoverProfile parses lines like "pkg/file.go:10.2,12.3 2 0"
+func parseGoCoverProfile(content string) coverageReport {
+	report := make(coverageReport)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		colon := strings.LastIndex(line, ":")
+		fields := strings.Fields(line[colon+1:])
+		if colon == -1 || len(fields) != 3 {
+			continue
+		}
+		file := line[:colon]
+
+		span := strings.Split(fields[0], ",")
+		if len(span) != 2 {
+			continue
+		}
+		start, err1 := strconv.Atoi(strings.Split(span[0], ".")[0])
+		end, err2 := strconv.Atoi(strings.Split(span[1], ".")[0])
+		count, err3 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+
+		if report[file] == nil {
+			report[file] = make(map[int]bool)
+		}
+		for l := start; l <= end; l++ {
+			// a line is covered if any block touching it was executed
+			report[file][l] = report[file][l] || count > 0
+		}
+	}
+	return report
+}
+
+// parseLcov parses SF:/DA: records of an lcov tracefile
+func parseLcov(content string) coverageReport {
+	report := make(coverageReport)
+	var file string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "SF:"):
+			file = strings.TrimPrefix(line, "SF:")
+			if report[file] == nil {
+				report[file] = make(map[int]bool)
+			}
+		case strings.HasPrefix(line, "DA:") && file != "":
+			parts := strings.Split(strings.TrimPrefix(line, "DA:"), ",")
+			if len(parts) < 2 {
+				continue
+			}
+			lineNumber, err1 := strconv.Atoi(parts[0])
+			hits, err2 := strconv.Atoi(parts[1])
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			report[file][lineNumber] = report[file][lineNumber] || hits > 0
+		case line == "end_of_record":
+			file = ""
+		}
+	}
+	return report
+}
+
+// lookup finds the coverage of a PR file. Report paths are often prefixed with the module path or an absolute
+// directory, so the report path ending with the PR path in the most path components wins, and so does a
+// relative report path the PR path ends with. A tie between several report paths is ambiguous, nil is returned.
+func (r coverageReport) lookup(filename string) map[int]bool {
+	if lines, ok := r[filename]; ok {
+		return lines
+	}
+
+	var best map[int]bool
+	bestLength, tied := 0, false
+	for path, lines := range r {
+		length := commonSuffixLength(path, filename)
+		switch {
+		case length == 0 || length < bestLength:
+		case length == bestLength:
+			tied = true
+		default:
+			best, bestLength, tied = lines, length, false
+		}
+	}
+	if tied {
+		return nil
+	}
+	return best
+}
+
+// commonSuffixLength returns the number of trailing path components a and b share, when all the components
+// of one of them are shared, or 0
+func commonSuffixLength(a, b string) int {
+	aParts, bParts := strings.Split(a, "/"), strings.Split(b, "/")
+	n := 0
+	for n < len(aParts) && n < len(bParts) && aParts[len(aParts)-1-n] == bParts[len(bParts)-1-n] {
+		n++
+	}
+	if n < len(aParts) && n < len(bParts) {
+		return 0
+	}
+	return n
+}
+
+// uncoveredAddedLines intersects the added lines of each file with the coverage report.
+// Lines the report doesn't know about (e.g. comments, declarations) are not reported.
+func uncoveredAddedLines(files []*github.CommitFile, report coverageReport) map[string][]int {
+	uncovered := make(map[string][]int)
+	for _, file := range files {
+		if file.Patch == nil {
+			continue
+		}
+		coverage := report.lookup(file.GetFilename())
+		if coverage == nil {
+			continue
+		}
+		for _, line := range addedLines(file.GetPatch()) {
+			if covered, known := coverage[line]; known && !covered {
+				uncovered[file.GetFilename()] = append(uncovered[file.GetFilename()], line)
+			}
+		}
+	}
+	return uncovered
+}
+
+// coveragePrompt builds the prompt section listing added lines that no test executes
+func coveragePrompt(uncovered map[string][]int) string {
+	if len(uncovered) == 0 {
+		return ""
+	}
+
+	var names []string
+	for name := range uncovered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("- %s: lines %s", name, formatLineRanges(uncovered[name])))
+	}
+
+	return fmt.Sprintf(`Test Coverage:
+
+According to the coverage report, these added lines are not covered by any test:
+%s
+
+Flag untested critical paths (error handling, edge cases, security relevant code) in your review.
+`, strings.Join(lines, "\n"))
+}
+
+// formatLineRanges compresses sorted line numbers into ranges, e.g. "3-5, 9"
+func formatLineRanges(lines []int) string {
+	var ranges []string
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(lines[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
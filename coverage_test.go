@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCoverageLookup(t *testing.T) {
+	module := map[int]bool{1: true}
+	other := map[int]bool{2: true}
+	relative := map[int]bool{3: true}
+	report := coverageReport{
+		"github.com/octocat/hello/pkg/api/handler.go":    module,
+		"github.com/octocat/hello/vendor/api/handler.go": other,
+		"util.go":                              relative,
+		"github.com/octocat/hello/a/config.go": module,
+		"github.com/octocat/hello/b/config.go": other,
+	}
+
+	tests := []struct {
+		filename string
+		want     map[int]bool
+	}{
+		{"pkg/api/handler.go", module},
+		{"internal/util.go", relative},
+		{"config.go", nil},
+		{"handler.go", nil},
+		{"missing.go", nil},
+	}
+	for _, test := range tests {
+		got := report.lookup(test.filename)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("lookup(%q) = %v, want %v", test.filename, got, test.want)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		if got := report.lookup("pkg/api/handler.go"); !got[1] {
+			t.Fatalf("lookup(%q) isn't deterministic, got %v", "pkg/api/handler.go", got)
+		}
+	}
+}
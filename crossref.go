@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// crossRefRe matches a "path/to/file.ext:line" reference, optionally wrapped in backticks
+var crossRefRe = regexp.MustCompile("`?([A-Za-z0-9_.\\-/]+\\.[A-Za-z0-9]+):([0-9]+)`?")
+
+// crossRefLinker turns file:line references in comments into permalinks at the PR's head commit
+type crossRefLinker struct {
+	ctx    context.Context
+	client *github.Client
+	pr     *github.PullRequest
+	// exists caches whether a path exists at the head commit
+	exists map[string]bool
+}
+
+func newCrossRefLinker(ctx context.Context, client *github.Client, pr *github.PullRequest, files []*github.CommitFile) *crossRefLinker {
+	linker := &crossRefLinker{ctx: ctx, client: client, pr: pr, exists: make(map[string]bool)}
+	for _, file := range files {
+		linker.exists[file.GetFilename()] = file.GetStatus() != "removed"
+	}
+	return linker
+}
+
+// fileExists reports whether the path exists in the repository at the head commit
+func (l *crossRefLinker) fileExists(path string) bool {
+	if exists, ok := l.exists[path]; ok {
+		return exists
+	}
+	repo := l.pr.GetBase().GetRepo()
+	_, _, _, err := l.client.Repositories.GetContents(l.ctx, repo.GetOwner().GetLogin(), repo.GetName(), path, &github.RepositoryContentGetOptions{Ref: l.pr.GetHead().GetSHA()})
+	l.exists[path] = err == nil
+	if err != nil {
+		logf(slog.LevelDebug, "Not linking %s, it isn't in the repository: %v\n", path, err)
+	}
+	return err == nil
+}
+
+// linkify replaces the references to existing files with markdown links; references already
+// inside a link are left alone
+func (l *crossRefLinker) linkify(body string) string {
+	if l == nil {
+		return body
+	}
+
+	var out []byte
+	last := 0
+	for _, m := range crossRefRe.FindAllStringSubmatchIndex(body, -1) {
+		start, end := m[0], m[1]
+		if start > 0 && (body[start-1] == '[' || body[start-1] == '/' || body[start-1] == '(') {
+			continue
+		}
+		path := body[m[2]:m[3]]
+		line, err := strconv.Atoi(body[m[4]:m[5]])
+		if err != nil || line == 0 || !l.fileExists(path) {
+			continue
+		}
+		out = append(out, body[last:start]...)
+		out = append(out, fmt.Sprintf("[`%s:%d`](%s)", path, line, blobLink(l.pr, path, line))...)
+		last = end
+	}
+	return string(append(out, body[last:]...))
+}
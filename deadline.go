@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// reviewPullRequestWithDeadline reviews a PR within opts.ReviewTimeout, so a pathological PR can't hold
+// the run forever. When the deadline is exceeded, a comment tells the author the review timed out.
+func reviewPullRequestWithDeadline(ctx context.Context, client *github.Client, opts runOptions, owner, repo string, prNumber int) (*reviewOutcome, error) {
+	if opts.ReviewTimeout <= 0 {
+		return reviewPullRequest(ctx, client, opts, owner, repo, prNumber)
+	}
+
+	reviewCtx, cancel := context.WithTimeout(ctx, opts.ReviewTimeout)
+	defer cancel()
+
+	outcome, err := reviewPullRequest(reviewCtx, client, opts, owner, repo, prNumber)
+	// when the run's own -timeout expired first, there's no time left for the comment
+	if !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		return outcome, err
+	}
+
+	outcome.State = "TIMED_OUT"
+	logf(slog.LevelWarn, "Review of PR #%d timed out after %s.\n", prNumber, opts.ReviewTimeout)
+	if opts.DryRun {
+		return outcome, err
+	}
+
+	// the review's context is done, the comment gets its own
+	body := fmt.Sprintf("The automated review timed out after %s and was cancelled. The PR may be too large to review automatically.\n\n%s", opts.ReviewTimeout, commentMarker)
+	_, _, commentErr := client.Issues.CreateComment(ctx, owner, repo, prNumber, &github.IssueComment{Body: github.String(body)})
+	if commentErr != nil {
+		logf(slog.LevelError, "Error posting the timeout comment: %v\n", commentErr)
+	}
+	return outcome, err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// normalizeCommentBody reduces a comment body to what tells two comments apart: without the tool's
+// marker, case and whitespace differences
+func normalizeCommentBody(body string) string {
+	body = strings.ReplaceAll(body, commentMarker, "")
+	return strings.ToLower(strings.Join(strings.Fields(body), " "))
+}
+
+// commentKey identifies a comment by its file, line and normalized body
+func commentKey(path string, line int, body string) string {
+	return fmt.Sprintf("%s:%d:%s", path, line, normalizeCommentBody(body))
+}
+
+// dropPostedComments removes the comments already posted on the PR, by a human or an earlier run,
+// on the same line with the same text
+func dropPostedComments(ctx context.Context, client *github.Client, owner, repo string, prNumber int, comments []*github.DraftReviewComment) ([]*github.DraftReviewComment, error) {
+	if len(comments) == 0 {
+		return comments, nil
+	}
+
+	posted := make(map[string]bool)
+	opts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		var page []*github.PullRequestComment
+		var resp *github.Response
+		err := withRateLimitRetry(ctx, func() (err error) {
+			page, resp, err = client.PullRequests.ListComments(ctx, owner, repo, prNumber, opts)
+			return err
+		})
+		if err != nil {
+			return comments, fmt.Errorf("error fetching review comments: %w", err)
+		}
+		for _, comment := range page {
+			posted[commentKey(comment.GetPath(), comment.GetLine(), comment.GetBody())] = true
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	var kept []*github.DraftReviewComment
+	for _, comment := range comments {
+		if posted[commentKey(comment.GetPath(), comment.GetLine(), comment.GetBody())] {
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	if dropped := len(comments) - len(kept); dropped > 0 {
+		logf(slog.LevelInfo, "Dropped %d comments already posted on the PR.\n", dropped)
+	}
+	return kept, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// parseUnifiedDiff splits a "git diff" style unified diff into per-file entries shaped like
+// the ones returned by PullRequests.ListFiles, with Patch holding the hunks of each file
+func parseUnifiedDiff(diff string) []*github.CommitFile {
+	var files []*github.CommitFile
+	var current *github.CommitFile
+	var patch []string
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		if len(patch) > 0 {
+			current.Patch = github.String(strings.Join(patch, "\n"))
+		}
+		current.Changes = github.Int(current.GetAdditions() + current.GetDeletions())
+		files = append(files, current)
+	}
+
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			current = &github.CommitFile{
+				Status:    github.String("modified"),
+				Additions: github.Int(0),
+				Deletions: github.Int(0),
+			}
+			patch = nil
+			// diff --git a/old b/new
+			if idx := strings.Index(line, " b/"); idx != -1 {
+				current.Filename = github.String(line[idx+3:])
+			}
+		case current == nil:
+			continue
+		case len(patch) > 0:
+			// inside the hunks, everything belongs to the patch
+			if strings.HasPrefix(line, "+") {
+				current.Additions = github.Int(current.GetAdditions() + 1)
+			} else if strings.HasPrefix(line, "-") {
+				current.Deletions = github.Int(current.GetDeletions() + 1)
+			}
+			patch = append(patch, line)
+		case strings.HasPrefix(line, "@@"):
+			patch = append(patch, line)
+		case strings.HasPrefix(line, "new file mode"):
+			current.Status = github.String("added")
+		case strings.HasPrefix(line, "new mode "):
+			// like GitHub, "changed" marks a file whose mode changed
+			current.Status = github.String("changed")
+		case strings.HasPrefix(line, "deleted file mode"):
+			current.Status = github.String("removed")
+		case strings.HasPrefix(line, "rename from "):
+			current.Status = github.String("renamed")
+			current.PreviousFilename = github.String(strings.TrimPrefix(line, "rename from "))
+		case strings.HasPrefix(line, "rename to "):
+			current.Filename = github.String(strings.TrimPrefix(line, "rename to "))
+		case strings.HasPrefix(line, "+++ b/"):
+			current.Filename = github.String(strings.TrimPrefix(line, "+++ b/"))
+		}
+	}
+	flush()
+
+	// the trailing newline of the diff leaves an empty context line in the last patch
+	if len(files) > 0 && files[len(files)-1].Patch != nil {
+		last := files[len(files)-1]
+		last.Patch = github.String(strings.TrimSuffix(last.GetPatch(), "\n"))
+	}
+
+	return files
+}
+
+// fetchTwoDotFiles returns the literal difference between the tips of the PR's base and head branches
+// (base..head), which also includes the changes made on the base branch since the head branched off,
+// shaped like the files returned by PullRequests.ListFiles
+func fetchTwoDotFiles(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest) ([]*github.CommitFile, error) {
+	u := fmt.Sprintf("repos/%s/%s/compare/%s..%s", owner, repo, pr.GetBase().GetSHA(), pr.GetHead().GetSHA())
+	req, err := client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3.diff")
+
+	var diff bytes.Buffer
+	_, err = client.Do(ctx, req, &diff)
+	if err != nil {
+		return nil, err
+	}
+	return parseUnifiedDiff(diff.String()), nil
+}
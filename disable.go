@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// defaultDisableMarker is the file repositories commit to opt out of automated reviews
+const defaultDisableMarker = ".github/ai-review-disabled"
+
+// reviewDisabled reports whether the repository opted out of automated reviews by committing
+// the marker file, as of the PR's head commit
+func reviewDisabled(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest, marker string) (bool, error) {
+	_, _, _, err := client.Repositories.GetContents(ctx, owner, repo, marker, &github.RepositoryContentGetOptions{Ref: pr.GetHead().GetSHA()})
+	if err != nil {
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
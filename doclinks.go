@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// categoryTagRe matches the "[category: name]" tag the model appends to a comment
+var categoryTagRe = regexp.MustCompile(`(?i)\s*\[category:\s*([a-z0-9_\- ]+)\]\s*$`)
+
+// loadDocLinks reads a JSON object mapping issue categories to documentation URLs, e.g.
+// {"sql-injection": "https://wiki.example.com/sql-injection"}
+func loadDocLinks(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading doc links file: %w", err)
+	}
+
+	var raw map[string]string
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing doc links file: %w", err)
+	}
+
+	links := make(map[string]string)
+	for category, url := range raw {
+		links[strings.ToLower(strings.TrimSpace(category))] = url
+	}
+	return links, nil
+}
+
+// docLinksPrompt asks the model to tag comments with one of the known categories
+func docLinksPrompt(links map[string]string) string {
+	if len(links) == 0 {
+		return ""
+	}
+
+	var categories []string
+	for category := range links {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	return fmt.Sprintf(`Comment Categories:
+
+When a specific comment is about one of the following categories, end the comment text with the tag [category: name], inside the double quotes. Categories: %s.
+
+Example:
+- File: "db.go", Line 12: "[blocker] the query is built by string concatenation [category: %s]"
+`, strings.Join(categories, ", "), categories[0])
+}
+
+// applyDocLink removes the category tag from a comment body and appends a link to the category's documentation.
+// Untagged comments are matched by the category name appearing in the text.
+func applyDocLink(body string, links map[string]string) string {
+	if len(links) == 0 {
+		return body
+	}
+
+	category := ""
+	if matches := categoryTagRe.FindStringSubmatch(body); matches != nil {
+		category = strings.ToLower(strings.TrimSpace(matches[1]))
+		body = categoryTagRe.ReplaceAllString(body, "")
+	} else {
+		lower := strings.ToLower(body)
+		for name := range links {
+			keyword := strings.NewReplacer("-", " ", "_", " ").Replace(name)
+			if strings.Contains(lower, keyword) && len(name) > len(category) {
+				category = name
+			}
+		}
+	}
+
+	url, ok := links[category]
+	if !ok {
+		return body
+	}
+	return fmt.Sprintf("%s\n\n📚 Learn more: [%s](%s)", body, category, url)
+}
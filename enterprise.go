@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// newGitHubClient returns a client of github.com, or of the GitHub Enterprise Server at baseURL when set.
+// baseURL can be the server's root (https://github.example.com) or its API URL (https://github.example.com/api/v3).
+func newGitHubClient(httpClient *http.Client, baseURL string) (*github.Client, error) {
+	if baseURL == "" {
+		return github.NewClient(httpClient), nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	// GITHUB_API_URL points to github.com in the Actions of github.com
+	if u.Host == "api.github.com" {
+		return github.NewClient(httpClient), nil
+	}
+	// the upload URL is derived from the same root, under /api/uploads/
+	return github.NewEnterpriseClient(baseURL, baseURL, httpClient)
+}
+
+// graphQLEndpoint is the GraphQL API's URL relative to the REST API's: api.github.com/graphql on github.com,
+// <host>/api/graphql on GitHub Enterprise Server, whose REST API is under /api/v3/
+func graphQLEndpoint(client *github.Client) string {
+	if strings.HasSuffix(client.BaseURL.Path, "/api/v3/") {
+		return "../graphql"
+	}
+	return "graphql"
+}
@@ -0,0 +1,31 @@
+package main
+
+import "os"
+
+// providerKeyEnv returns the environment variable holding the API key of a model provider
+func providerKeyEnv(provider string) string {
+	if provider == "anthropic" {
+		return "ANTHROPIC_API_KEY"
+	}
+	return "OPENAI_API_KEY"
+}
+
+// missingEnv returns the environment variables the run needs that aren't set: the model provider's API key,
+// unless the review doesn't use a model, and the code host's token, which a GitHub App's credentials replace on GitHub
+func missingEnv(provider, forge string, noAI bool) []string {
+	var missing []string
+	if !noAI && os.Getenv(providerKeyEnv(provider)) == "" {
+		missing = append(missing, providerKeyEnv(provider))
+	}
+	switch forge {
+	case "gitlab":
+		if os.Getenv("GITLAB_TOKEN") == "" {
+			missing = append(missing, "GITLAB_TOKEN")
+		}
+	default:
+		if os.Getenv("GITHUB_TOKEN") == "" && os.Getenv("GITHUB_APP_ID") == "" {
+			missing = append(missing, "GITHUB_TOKEN")
+		}
+	}
+	return missing
+}
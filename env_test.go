@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissingEnv(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("ANTHROPIC_API_KEY", "key")
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GITHUB_APP_ID", "")
+	t.Setenv("GITLAB_TOKEN", "token")
+
+	tests := []struct {
+		provider, forge string
+		noAI            bool
+		want            []string
+	}{
+		{"openai", "github", false, []string{"OPENAI_API_KEY", "GITHUB_TOKEN"}},
+		{"openai", "github", true, []string{"GITHUB_TOKEN"}},
+		{"anthropic", "gitlab", false, nil},
+		{"openai", "gitlab", true, nil},
+	}
+	for _, test := range tests {
+		if got := missingEnv(test.provider, test.forge, test.noAI); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("missingEnv(%q, %q, %v) = %v, want %v", test.provider, test.forge, test.noAI, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// escalationMarker tags the comment recording that a PR was escalated, so it happens only once
+const escalationMarker = "<!-- gh-pr-reviewer:escalated -->"
+
+// severityRank returns the position of a severity in severities, most serious first, or len(severities) when untagged
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return len(severities)
+}
+
+// escalationFindings returns the comments at least as serious as the threshold severity
+func escalationFindings(comments []*github.DraftReviewComment, threshold string) []*github.DraftReviewComment {
+	var serious []*github.DraftReviewComment
+	for _, comment := range comments {
+		if severityRank(commentSeverity(comment.GetBody())) <= severityRank(threshold) {
+			serious = append(serious, comment)
+		}
+	}
+	return serious
+}
+
+// alreadyEscalated reports whether an earlier run escalated the PR
+func alreadyEscalated(ctx context.Context, client *github.Client, owner, repo string, prNumber int) (bool, error) {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		var comments []*github.IssueComment
+		var resp *github.Response
+		err := withRateLimitRetry(ctx, func() (err error) {
+			comments, resp, err = client.Issues.ListComments(ctx, owner, repo, prNumber, opts)
+			return err
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.GetBody(), escalationMarker) {
+				return true, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return false, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// escalate requests a review from the given users and teams ("org/team" or "team") and records it with a comment
+func escalate(ctx context.Context, client *github.Client, owner, repo string, prNumber int, reviewers []string, serious []*github.DraftReviewComment) error {
+	escalated, err := alreadyEscalated(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return fmt.Errorf("error checking for an earlier escalation: %w", err)
+	}
+	if escalated {
+		return nil
+	}
+
+	var request github.ReviewersRequest
+	var mentions []string
+	for _, reviewer := range reviewers {
+		reviewer = strings.TrimPrefix(reviewer, "@")
+		if org, team, ok := strings.Cut(reviewer, "/"); ok {
+			request.TeamReviewers = append(request.TeamReviewers, team)
+			mentions = append(mentions, "@"+org+"/"+team)
+		} else {
+			request.Reviewers = append(request.Reviewers, reviewer)
+			mentions = append(mentions, "@"+reviewer)
+		}
+	}
+
+	err = withRateLimitRetry(ctx, func() (err error) {
+		_, _, err = client.PullRequests.RequestReviewers(ctx, owner, repo, prNumber, request)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error requesting reviewers: %w", err)
+	}
+
+	var locations []string
+	for _, comment := range serious {
+		locations = append(locations, fmt.Sprintf("- `%s:%d` %s", comment.GetPath(), comment.GetLine(), comment.GetBody()))
+	}
+	body := fmt.Sprintf("The automated review found serious issues and requested a review from %s:\n\n%s\n\n%s\n%s",
+		strings.Join(mentions, ", "), strings.Join(locations, "\n"), escalationMarker, commentMarker)
+	err = withRateLimitRetry(ctx, func() (err error) {
+		_, _, err = client.Issues.CreateComment(ctx, owner, repo, prNumber, &github.IssueComment{Body: github.String(body)})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error recording the escalation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+func TestEscalateRetriesRateLimitedCalls(t *testing.T) {
+	limited := map[string]bool{}
+	var requested, recorded bool
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := r.Method + " " + r.URL.Path
+		// every call is rate limited once, the limit resetting right away
+		if !limited[call] {
+			limited[call] = true
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message":"API rate limit exceeded"}`)
+			return
+		}
+		switch call {
+		case "GET /repos/octocat/hello/issues/7/comments":
+			fmt.Fprint(w, `[]`)
+		case "POST /repos/octocat/hello/pulls/7/requested_reviewers":
+			requested = true
+			fmt.Fprint(w, `{}`)
+		case "POST /repos/octocat/hello/issues/7/comments":
+			recorded = true
+			fmt.Fprint(w, `{}`)
+		default:
+			t.Errorf("unexpected request %s", call)
+			http.NotFound(w, r)
+		}
+	}))
+
+	serious := []*github.DraftReviewComment{{Path: github.String("main.go"), Line: github.Int(3), Body: github.String("[blocker] Leak")}}
+	err := escalate(context.Background(), client, "octocat", "hello", 7, []string{"alice", "octocat/security"}, serious)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !requested || !recorded {
+		t.Errorf("reviewers requested: %v, escalation recorded: %v, want both after the rate limits", requested, recorded)
+	}
+	if len(limited) != 3 {
+		t.Errorf("got rate-limited calls %v, want the 3 escalation calls", limited)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/google/go-github/v55/github"
+)
+
+// repoIgnoreFile lists, in the root of the reviewed repository, globs of files left out of the review
+const repoIgnoreFile = ".gh-pr-reviewer-ignore"
+
+// stringsFlag is a flag that can be repeated, collecting every value
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	if !doublestar.ValidatePattern(value) {
+		return fmt.Errorf("invalid glob %q", value)
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+// parseIgnoreFile parses globs, one per line. Blank lines and lines starting with # are ignored.
+func parseIgnoreFile(content string) ([]string, error) {
+	var globs []string
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !doublestar.ValidatePattern(line) {
+			return nil, fmt.Errorf("invalid glob %q on line %d", line, i+1)
+		}
+		globs = append(globs, line)
+	}
+	return globs, nil
+}
+
+// repoIgnoreGlobs reads the globs of the repository's ignore file at the PR's head commit,
+// a repository without one has no globs
+func repoIgnoreGlobs(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest) ([]string, error) {
+	file, _, _, err := client.Repositories.GetContents(ctx, owner, repo, repoIgnoreFile, &github.RepositoryContentGetOptions{Ref: pr.GetHead().GetSHA()})
+	if err != nil {
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	globs, err := parseIgnoreFile(content)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", repoIgnoreFile, err)
+	}
+	return globs, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/google/go-github/v55/github"
+)
+
+// listPullRequestFiles returns every file changed by the PR, walking all the pages of the listing
+// (GitHub returns at most 3000 files)
+func listPullRequestFiles(ctx context.Context, client *github.Client, owner, repo string, prNumber int) ([]*github.CommitFile, error) {
+	var files []*github.CommitFile
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		var page []*github.CommitFile
+		var resp *github.Response
+		err := withRateLimitRetry(ctx, func() (err error) {
+			page, resp, err = client.PullRequests.ListFiles(ctx, owner, repo, prNumber, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return files, nil
+}
+
+// excludeFiles drops the files matching one of the globs. Like in .gitignore, globs without
+// a slash match the file name in any directory.
+func excludeFiles(files []*github.CommitFile, globs []string) []*github.CommitFile {
+	if len(globs) == 0 {
+		return files
+	}
+
+	var kept []*github.CommitFile
+	for _, file := range files {
+		excluded := false
+		for _, pattern := range globs {
+			name := file.GetFilename()
+			if !strings.Contains(pattern, "/") {
+				name = path.Base(name)
+			}
+			if ok, _ := doublestar.Match(pattern, name); ok {
+				logf(slog.LevelDebug, "Excluding %s from the review (matches %q)\n", file.GetFilename(), pattern)
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
+
+// prioritizeFiles orders the files so the most important ones come first:
+// source files before tests, docs and lock files, and larger changes before smaller ones
+func prioritizeFiles(files []*github.CommitFile) []*github.CommitFile {
+	sorted := make([]*github.CommitFile, len(files))
+	copy(sorted, files)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		wi, wj := fileWeight(sorted[i]), fileWeight(sorted[j])
+		if wi != wj {
+			return wi > wj
+		}
+		return sorted[i].GetChanges() > sorted[j].GetChanges()
+	})
+	return sorted
+}
+
+// fileWeight returns a rough importance score for a changed file
+func fileWeight(file *github.CommitFile) int {
+	name := strings.ToLower(file.GetFilename())
+	base := path.Base(name)
+
+	switch {
+	case isTestFile(name):
+		return 1
+	case strings.HasSuffix(base, ".md"), strings.HasSuffix(base, ".txt"), strings.HasPrefix(name, "docs/"):
+		return 0
+	case strings.HasSuffix(base, ".lock"), base == "go.sum", base == "package-lock.json":
+		return 0
+	}
+	return 2
+}
+
+// isTestFile reports whether the path looks like a test file
+func isTestFile(name string) bool {
+	name = strings.ToLower(name)
+	base := path.Base(name)
+	return strings.HasSuffix(base, "_test.go") ||
+		strings.Contains(base, ".test.") ||
+		strings.Contains(base, ".spec.") ||
+		strings.HasPrefix(base, "test_") ||
+		strings.Contains(name, "/test/") ||
+		strings.Contains(name, "/tests/") ||
+		strings.HasPrefix(name, "test/") ||
+		strings.HasPrefix(name, "tests/")
+}
+
+// addedLines returns the new-file line numbers of every line added by the patch
+func addedLines(patch string) []int {
+	var added []int
+	lineNumber := 0
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			// @@ -1,3 +4,5 @@ means the hunk starts at line 4 of the new file
+			parts := strings.Split(line, " ")
+			if len(parts) >= 3 {
+				lineNumber, _ = strconv.Atoi(strings.Split(strings.TrimPrefix(parts[2], "+"), ",")[0])
+			}
+		case strings.HasPrefix(line, "+"):
+			added = append(added, lineNumber)
+			lineNumber++
+		case strings.HasPrefix(line, "-"), strings.HasPrefix(line, "\\"):
+			// removed lines and "\ No newline at end of file" don't exist in the new file
+		default:
+			lineNumber++
+		}
+	}
+	return added
+}
+
+// commentableLines maps the new-file line numbers a review comment can target (added and context
+// lines of the patch's hunks) to their content
+func commentableLines(patch string) map[int]string {
+	lines := make(map[int]string)
+	lineNumber := 0
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			parts := strings.Split(line, " ")
+			if len(parts) >= 3 {
+				lineNumber, _ = strconv.Atoi(strings.Split(strings.TrimPrefix(parts[2], "+"), ",")[0])
+			}
+		case strings.HasPrefix(line, "-"), strings.HasPrefix(line, "\\"):
+		case lineNumber > 0:
+			if len(line) > 0 {
+				line = line[1:]
+			}
+			lines[lineNumber] = line
+			lineNumber++
+		}
+	}
+	return lines
+}
+
+// trivialChange describes a file whose content didn't change, a pure rename or a mode change,
+// or returns "" when the file has content changes to review
+func trivialChange(file *github.CommitFile) string {
+	if file.GetPatch() != "" || file.GetChanges() != 0 {
+		return ""
+	}
+	switch file.GetStatus() {
+	case "renamed":
+		return fmt.Sprintf("renamed `%s` → `%s`", file.GetPreviousFilename(), file.GetFilename())
+	case "changed":
+		return fmt.Sprintf("mode changed on `%s`", file.GetFilename())
+	}
+	return ""
+}
+
+// fileMetadata describes a file that has no patch to show, e.g. "File: old.go -> new.go (renamed, +0/-0)"
+func fileMetadata(file *github.CommitFile) string {
+	name := file.GetFilename()
+	kind := file.GetStatus()
+	switch kind {
+	case "renamed":
+		name = file.GetPreviousFilename() + " -> " + name
+	case "removed":
+		kind = "deleted"
+	case "changed":
+		kind = "mode changed"
+	case "added", "modified", "copied":
+		// a file with content changes but no patch is binary or too large for GitHub to diff
+		kind = "binary or too large to diff, " + kind
+	}
+	return fmt.Sprintf("File: %s (%s, +%d/-%d)", name, kind, file.GetAdditions(), file.GetDeletions())
+}
+
+// removedLines maps the old-file line numbers of the lines removed by the patch to their content
+func removedLines(patch string) map[int]string {
+	lines := make(map[int]string)
+	lineNumber := 0
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			// @@ -1,3 +4,5 @@ means the hunk starts at line 1 of the old file
+			parts := strings.Split(line, " ")
+			if len(parts) >= 2 {
+				lineNumber, _ = strconv.Atoi(strings.Split(strings.TrimPrefix(parts[1], "-"), ",")[0])
+			}
+		case strings.HasPrefix(line, "+"), strings.HasPrefix(line, "\\"):
+			// added lines and "\ No newline at end of file" don't exist in the old file
+		case strings.HasPrefix(line, "-"):
+			lines[lineNumber] = line[1:]
+			lineNumber++
+		case lineNumber > 0:
+			lineNumber++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// newTestClient returns a GitHub client sending its requests to a test server serving handler
+func newTestClient(t *testing.T, handler http.Handler) *github.Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+// pagedHandler serves pages[n-1] as the JSON body of ?page=n, linking each page to the next one
+func pagedHandler(t *testing.T, path string, pages []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		page := 1
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+		if page < 1 || page > len(pages) {
+			t.Errorf("unexpected page %d", page)
+			http.NotFound(w, r)
+			return
+		}
+		if page < len(pages) {
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=%d&per_page=100>; rel="next"`, r.Host, path, page+1))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, pages[page-1])
+	})
+}
+
+func TestListPullRequestFilesWalksAllPages(t *testing.T) {
+	client := newTestClient(t, pagedHandler(t, "/repos/octocat/hello/pulls/7/files", []string{
+		`[{"filename":"a.go"},{"filename":"b.go"}]`,
+		`[{"filename":"c.go"}]`,
+	}))
+
+	files, err := listPullRequestFiles(context.Background(), client, "octocat", "hello", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.GetFilename())
+	}
+	if fmt.Sprint(names) != "[a.go b.go c.go]" {
+		t.Errorf("got files %v, want the files of both pages", names)
+	}
+}
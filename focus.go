@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// reviewCommentThread fetches the first comment of the thread containing commentID and the replies made to it
+func reviewCommentThread(ctx context.Context, client *github.Client, owner, repo string, prNumber int, commentID int64) (*github.PullRequestComment, []*github.PullRequestComment, error) {
+	root, _, err := client.PullRequests.GetComment(ctx, owner, repo, commentID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error fetching review comment %d: %w", commentID, err)
+	}
+	if root.GetInReplyTo() != 0 {
+		commentID = root.GetInReplyTo()
+		root, _, err = client.PullRequests.GetComment(ctx, owner, repo, commentID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error fetching review comment %d: %w", commentID, err)
+		}
+	}
+
+	var replies []*github.PullRequestComment
+	opts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := client.PullRequests.ListComments(ctx, owner, repo, prNumber, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error fetching review comments: %w", err)
+		}
+		for _, comment := range comments {
+			if comment.GetInReplyTo() == commentID {
+				replies = append(replies, comment)
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return root, replies, nil
+}
+
+// focusPrompt asks the model for a deep-dive on the location of a single review thread
+func focusPrompt(pr *github.PullRequest, file *github.CommitFile, root *github.PullRequestComment, replies []*github.PullRequestComment) string {
+	line := root.GetLine()
+	if line == 0 {
+		line = root.GetOriginalLine()
+	}
+
+	var thread []string
+	thread = append(thread, fmt.Sprintf("%s: %s", root.GetUser().GetLogin(), root.GetBody()))
+	for _, reply := range replies {
+		thread = append(thread, fmt.Sprintf("%s: %s", reply.GetUser().GetLogin(), reply.GetBody()))
+	}
+
+	patch := ""
+	if file != nil {
+		patch = simplifyPatch([]*github.CommitFile{file})
+	}
+
+	return fmt.Sprintf(`
+	PR %s by %s
+
+	A reviewer asked for a deep-dive on line %d of the file %s. Focus only on this location and the code around it; do not review the rest of the PR.
+
+	Diff hunk around the location:
+	%s
+
+	Review thread so far:
+	%s
+
+	Changes to the file:
+	%s
+
+	Address the reviewer's concern directly: explain whether there is a problem at this location, why, and how to fix it. Answer in concise markdown suitable for a reply in the review thread.
+	`, pr.GetTitle(), pr.GetUser().GetLogin(), line, root.GetPath(), root.GetDiffHunk(), strings.Join(thread, "\n"), patch)
+}
+
+// reviewFocusComment asks the model to expand on an existing review thread and posts the analysis as a reply
+func reviewFocusComment(ctx context.Context, client *github.Client, opts runOptions, owner, repo string, prNumber int, commentID int64) error {
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, prNumber)
+	if err != nil {
+		return fmt.Errorf("error fetching PR details: %w", err)
+	}
+
+	root, replies, err := reviewCommentThread(ctx, client, owner, repo, prNumber, commentID)
+	if err != nil {
+		return err
+	}
+
+	files, err := listPullRequestFiles(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return fmt.Errorf("error fetching PR files: %w", err)
+	}
+
+	// Constrain the review to the thread's file
+	var file *github.CommitFile
+	for _, f := range files {
+		if f.GetFilename() == root.GetPath() {
+			file = f
+			break
+		}
+	}
+	if file == nil {
+		logf(slog.LevelWarn, "File %s is not part of the current diff, using the thread's diff hunk only.", root.GetPath())
+	}
+
+	resp, err := createCompletion(ctx, opts.Completion, focusPrompt(pr, file, root, replies))
+	if err != nil {
+		return fmt.Errorf("error generating analysis: %w", err)
+	}
+	analysis := resp.Choices[0].Message.Content
+
+	logf(slog.LevelDebug, "------- Focused Analysis:\n%s\n-------", analysis)
+
+	if opts.DryRun {
+		logf(slog.LevelInfo, "Dry run: Reply not posted to GitHub.")
+		return nil
+	}
+
+	// Replies go to the thread's first comment
+	_, _, err = client.PullRequests.CreateCommentInReplyTo(ctx, owner, repo, prNumber, analysis+"\n\n"+commentMarker, root.GetID())
+	if err != nil {
+		return fmt.Errorf("error posting reply: %w", err)
+	}
+	slog.Info("Analysis posted as a reply to the review thread.")
+	return nil
+}
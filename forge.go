@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// forge is the code host of the reviewed changes. Whatever the host, the changes come back shaped like
+// go-github's types, so building the prompt and extracting the comments don't depend on it.
+type forge interface {
+	// PullRequest returns the PR (a merge request on GitLab)
+	PullRequest(ctx context.Context, owner, repo string, number int) (*github.PullRequest, error)
+	// Files returns the changed files of the PR with their patches
+	Files(ctx context.Context, owner, repo string, number int) ([]*github.CommitFile, error)
+	// Reviews returns the reviews of the PR
+	Reviews(ctx context.Context, owner, repo string, number int) ([]*github.PullRequestReview, error)
+	// ChecksPassed reports whether none of the CI checks gating the PR's head failed, and lists
+	// those that haven't completed yet
+	ChecksPassed(ctx context.Context, owner, repo string, pr *github.PullRequest) (bool, []string, error)
+	// PostReview posts the review body and its line comments with the given state
+	PostReview(ctx context.Context, owner, repo string, number int, review string, comments []*github.DraftReviewComment, files []*github.CommitFile, state string, opts postOptions) error
+}
+
+// githubForge is the forge of the PRs on GitHub
+type githubForge struct {
+	client *github.Client
+	// requiredChecks overrides the required checks of the branch protection
+	requiredChecks []string
+	// checksWait is how long to wait for the pending checks to complete
+	checksWait time.Duration
+}
+
+func (g githubForge) PullRequest(ctx context.Context, owner, repo string, number int) (*github.PullRequest, error) {
+	var pr *github.PullRequest
+	err := withRateLimitRetry(ctx, func() (err error) {
+		pr, _, err = g.client.PullRequests.Get(ctx, owner, repo, number)
+		return err
+	})
+	return pr, err
+}
+
+func (g githubForge) Files(ctx context.Context, owner, repo string, number int) ([]*github.CommitFile, error) {
+	return listPullRequestFiles(ctx, g.client, owner, repo, number)
+}
+
+func (g githubForge) Reviews(ctx context.Context, owner, repo string, number int) ([]*github.PullRequestReview, error) {
+	return listReviews(g.client, ctx, owner, repo, number)
+}
+
+// ChecksPassed waits up to checksWait for the pending checks to complete, unless a required one already failed
+func (g githubForge) ChecksPassed(ctx context.Context, owner, repo string, pr *github.PullRequest) (bool, []string, error) {
+	required := requiredChecks(ctx, g.client, owner, repo, pr.GetBase().GetRef(), g.requiredChecks)
+	deadline := time.Now().Add(g.checksWait)
+	for {
+		var checks *github.ListCheckRunsResults
+		err := withRateLimitRetry(ctx, func() (err error) {
+			checks, _, err = g.client.Checks.ListCheckRunsForRef(ctx, owner, repo, pr.GetHead().GetSHA(), &github.ListCheckRunsOptions{})
+			return err
+		})
+		if err != nil {
+			return false, nil, err
+		}
+
+		// If a required check has failed, do not allow approval
+		var failed, pending []string
+		for _, check := range checks.CheckRuns {
+			if check.GetConclusion() == "failure" {
+				failed = append(failed, check.GetName())
+			} else if check.GetStatus() != "completed" {
+				pending = append(pending, check.GetName())
+			}
+		}
+		pending = gatingChecks(pending, required)
+		if len(pending) == 0 || len(gatingChecks(failed, required)) > 0 || !time.Now().Before(deadline) {
+			return requiredChecksPassed(failed, required), pending, nil
+		}
+
+		logf(slog.LevelInfo, "Waiting for the checks %s to complete...\n", strings.Join(pending, ", "))
+		select {
+		case <-ctx.Done():
+			return false, nil, ctx.Err()
+		case <-time.After(checksPollInterval):
+		}
+	}
+}
+
+func (g githubForge) PostReview(ctx context.Context, owner, repo string, number int, review string, comments []*github.DraftReviewComment, files []*github.CommitFile, state string, opts postOptions) error {
+	return postReviewRetryingStaleDiff(g.client, ctx, owner, repo, number, review, comments, files, state, opts)
+}
+
+// reviewWithForge reviews a PR using only the calls of the forge interface. The features needing
+// GitHub's other APIs (the saved reviews, the repository ignore file, the extra sections...) are left out.
+func reviewWithForge(ctx context.Context, host forge, opts runOptions, owner, repo string, number int) (*reviewOutcome, error) {
+	opts = opts.forRepo(owner, repo)
+	outcome := &reviewOutcome{Owner: owner, Repo: repo, Number: number}
+
+	pr, err := host.PullRequest(ctx, owner, repo, number)
+	if err != nil {
+		return outcome, outcome.fail(fmt.Errorf("error fetching PR details: %w", err))
+	}
+	outcome.Title = pr.GetTitle()
+	outcome.URL = pr.GetHTMLURL()
+	outcome.HeadSHA = pr.GetHead().GetSHA()
+
+	if !opts.ReviewWIP && isWorkInProgress(pr, opts.WIPPrefixes) {
+		logf(slog.LevelInfo, "PR #%d is a draft or work in progress, skipping it (use -review-wip to review it anyway).\n", number)
+		outcome.State = "SKIPPED"
+		return outcome, nil
+	}
+
+	pendingReview, err := getPendingReview(host, ctx, owner, repo, number)
+	if err != nil {
+		return outcome, outcome.fail(fmt.Errorf("error checking for pending reviews: %w", err))
+	}
+	if pendingReview != nil {
+		return outcome, outcome.fail(fmt.Errorf("a pending review already exists, submit or dismiss it first"))
+	}
+
+	checksPassed, pendingChecks, err := host.ChecksPassed(ctx, owner, repo, pr)
+	if err != nil {
+		return outcome, outcome.fail(fmt.Errorf("error fetching PR checks: %w", err))
+	}
+	files, err := host.Files(ctx, owner, repo, number)
+	if err != nil {
+		return outcome, outcome.fail(fmt.Errorf("error fetching PR files: %w", err))
+	}
+	changedFiles := files
+	files = excludeFiles(files, opts.IgnoreGlobs)
+
+	genOpts, err := generationOptions(opts, files)
+	if err != nil {
+		return outcome, outcome.fail(err)
+	}
+	var generated *generatedReview
+	if opts.NoAI {
+		generated = deterministicReview(files, opts, genOpts.Uncovered)
+	} else {
+		generated, err = generateReviewWithAssistant(ctx, pr, files, genOpts)
+		if err != nil {
+			return outcome, outcome.fail(fmt.Errorf("error generating review: %w", err))
+		}
+	}
+	review, reviewComments, action := generated.Review, generated.Comments, generated.Action
+	if opts.CommentedCodeLines > 0 && !opts.SummaryOnly && !opts.NoAI {
+		found := commentedCodeComments(files, opts.CommentedCodeLines, opts.CommentedCodeLangs)
+		addSeverityIcons(found, opts.SeverityIcons)
+		reviewComments = mergeCommentedCode(reviewComments, found)
+	}
+	if opts.SummaryOnly {
+		reviewComments = nil
+	}
+	review, reviewComments = capComments(review, reviewComments, opts.MaxComments)
+	outcome.Usage = generated.Usage
+	outcome.Cost = estimateCost(generated.Model, generated.Usage)
+
+	state := reviewEvent(action, checksPassed, reviewComments, opts.SeverityEvents)
+	if state == "APPROVE" && len(pendingChecks) > 0 {
+		logf(slog.LevelInfo, "Checks still running, posting a comment instead of an approval: %s\n", strings.Join(pendingChecks, ", "))
+		state = "COMMENT"
+		review += "\n\n" + pendingChecksNote(pendingChecks)
+	}
+	if state == "APPROVE" {
+		if matched := opts.ApprovalPolicy.matchedConditions(changedFiles); len(matched) > 0 {
+			logf(slog.LevelInfo, "Approval policy conditions met, posting a comment instead of an approval: %s\n", strings.Join(matched, "; "))
+			state = "COMMENT"
+			review += "\n\n" + requiresHumanApprovalNote(matched)
+		}
+	}
+	outcome.State = state
+	outcome.Comments = len(reviewComments)
+	outcome.Review, outcome.Action, outcome.ReviewComments = review, action, reviewComments
+	outcome.ChecksPassed = github.Bool(checksPassed)
+
+	logf(slog.LevelDebug, "------- Generated Review:\n%s", review)
+	if opts.DryRun || opts.ForceDry {
+		logf(slog.LevelInfo, "Dry run: Review not posted.")
+		return outcome, nil
+	}
+
+	err = host.PostReview(ctx, owner, repo, number, review, reviewComments, files, state, postOptions{BodyHeader: opts.BodyHeader, BodyFooter: opts.BodyFooter})
+	if err != nil {
+		return outcome, outcome.fail(fmt.Errorf("error posting review: %w", err))
+	}
+	slog.Info("Review posted successfully!")
+	outcome.Posted = true
+	return outcome, nil
+}
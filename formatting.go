@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// formattingCommentRe matches comments that are only about code formatting. It only matches phrases that
+// can't be about the code's behavior: quotes, semicolons or line breaks alone may well be a real issue.
+var formattingCommentRe = regexp.MustCompile(`(?i)\b(trailing (whitespace|spaces?)|(inconsistent|incorrect|wrong|mixed|extra|missing) (indentation|spacing|whitespace|blank lines?)|(indentation|spacing|whitespace) (is|looks) (off|inconsistent|wrong)|tabs? (vs\.?|instead of) spaces|spaces instead of tabs|import order(ing)?|(sort|reorder|group) (the )?imports|line (is )?too long|(run|apply) (gofmt|goimports|prettier|the formatter)|not (gofmt|prettier)(-| )formatted)\b`)
+
+// parseFormatters parses a list like "go=gofmt,js=prettier" into a map of file extension to formatter
+func parseFormatters(value string) (map[string]string, error) {
+	formatters := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ext, formatter, ok := strings.Cut(entry, "=")
+		if !ok || ext == "" || formatter == "" {
+			return nil, fmt.Errorf("invalid formatter entry %q, expected <extension>=<formatter>", entry)
+		}
+		formatters[strings.TrimPrefix(strings.ToLower(ext), ".")] = formatter
+	}
+	return formatters, nil
+}
+
+// formatterFor returns the formatter enforced for the file, if any
+func formatterFor(filename string, formatters map[string]string) string {
+	return formatters[strings.TrimPrefix(strings.ToLower(path.Ext(filename)), ".")]
+}
+
+// formattersPrompt tells the model to skip formatting comments on formatter-owned files
+func formattersPrompt(formatters map[string]string) string {
+	if len(formatters) == 0 {
+		return ""
+	}
+
+	var entries []string
+	for ext, formatter := range formatters {
+		entries = append(entries, fmt.Sprintf(".%s (%s)", ext, formatter))
+	}
+	sort.Strings(entries)
+
+	return fmt.Sprintf(`Formatting:
+
+Files with the extensions %s are formatted automatically in CI. Do not comment on pure formatting of these files (indentation, whitespace, line breaks, quotes, import ordering).
+`, strings.Join(entries, ", "))
+}
+
+// filterFormattingComments drops comments about formatting on files owned by an enforced formatter
+func filterFormattingComments(comments []*github.DraftReviewComment, formatters map[string]string) []*github.DraftReviewComment {
+	if len(formatters) == 0 {
+		return comments
+	}
+
+	var kept []*github.DraftReviewComment
+	for _, comment := range comments {
+		formatter := formatterFor(comment.GetPath(), formatters)
+		if formatter != "" && formattingCommentRe.MatchString(comment.GetBody()) {
+			logf(slog.LevelDebug, "Dropping formatting comment on %s:%d (enforced by %s)", comment.GetPath(), comment.GetLine(), formatter)
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
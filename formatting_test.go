@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+)
+
+func TestFilterFormattingComments(t *testing.T) {
+	formatters := map[string]string{"go": "gofmt"}
+	tests := []struct {
+		path, body string
+		dropped    bool
+	}{
+		{"main.go", "[nit] Inconsistent indentation in this block.", true},
+		{"main.go", "[nit] Trailing whitespace.", true},
+		{"main.go", "[nit] Run gofmt on this file.", true},
+		{"main.go", "[nit] Fix the import ordering.", true},
+		{"main.go", "[major] The double quotes break the SQL query, use placeholders.", false},
+		{"main.go", "[minor] The output isn't formatted as JSON when -format=json is set.", false},
+		{"main.go", "[major] Missing semicolons in the generated JavaScript make it fail to parse.", false},
+		{"main.go", "[minor] Line breaks in the header value allow header injection.", false},
+		{"app.js", "[nit] Inconsistent indentation in this block.", false},
+	}
+	for _, test := range tests {
+		comment := &github.DraftReviewComment{Path: github.String(test.path), Line: github.Int(1), Body: github.String(test.body)}
+		kept := filterFormattingComments([]*github.DraftReviewComment{comment}, formatters)
+		if dropped := len(kept) == 0; dropped != test.dropped {
+			t.Errorf("comment %q on %s dropped: %v, want %v", test.body, test.path, dropped, test.dropped)
+		}
+	}
+}
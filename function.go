@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// functionScope is the range of lines (1-based, inclusive) of a function definition in a file
+type functionScope struct {
+	Start int
+	End   int
+}
+
+// findFunctionScope locates the definition of the named function in a source file. Go files are
+// parsed, Python scopes end with the indentation, and C-like languages with the matching brace.
+// It returns false when the language isn't supported or the function isn't defined in the file.
+func findFunctionScope(filename, src, name string) (functionScope, bool) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".go":
+		return goFunctionScope(filename, src, name)
+	case ".py":
+		return indentedFunctionScope(src, regexp.MustCompile(`^(\s*)(?:async\s+)?def\s+`+regexp.QuoteMeta(name)+`\s*\(`))
+	case ".js", ".jsx", ".ts", ".tsx", ".java", ".c", ".cc", ".cpp", ".h", ".hpp", ".cs", ".rs", ".kt", ".swift", ".php":
+		return bracedFunctionScope(src, bracedDefinitionRe(name))
+	}
+	return functionScope{}, false
+}
+
+// goFunctionScope finds a Go function or method, named either Name or Type.Name
+func goFunctionScope(filename, src, name string) (functionScope, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
+	if err != nil {
+		logf(slog.LevelError, "Error parsing %s: %v\n", filename, err)
+		return functionScope{}, false
+	}
+
+	recv, funcName, isMethod := strings.Cut(name, ".")
+	if !isMethod {
+		funcName = name
+	}
+	// a plain name prefers a function over a method of the same name
+	var found *ast.FuncDecl
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != funcName {
+			continue
+		}
+		hasRecv := fn.Recv != nil && len(fn.Recv.List) > 0
+		if isMethod && (!hasRecv || receiverType(fn.Recv.List[0].Type) != recv) {
+			continue
+		}
+		if found == nil || (!isMethod && !hasRecv) {
+			found = fn
+		}
+	}
+	if found == nil {
+		return functionScope{}, false
+	}
+	return functionScope{Start: fset.Position(found.Pos()).Line, End: fset.Position(found.End()).Line}, true
+}
+
+// receiverType returns the type name of a method receiver, without pointer and type parameters
+func receiverType(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(t.X)
+	case *ast.IndexExpr:
+		return receiverType(t.X)
+	case *ast.IndexListExpr:
+		return receiverType(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// indentedFunctionScope finds a definition whose body is the following more indented lines
+func indentedFunctionScope(src string, definition *regexp.Regexp) (functionScope, bool) {
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		matches := definition.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		indent := len(matches[1])
+		end := i
+		for j := i + 1; j < len(lines); j++ {
+			trimmed := strings.TrimSpace(lines[j])
+			if trimmed == "" {
+				continue
+			}
+			if len(lines[j])-len(strings.TrimLeft(lines[j], " \t")) <= indent {
+				break
+			}
+			end = j
+		}
+		return functionScope{Start: i + 1, End: end + 1}, true
+	}
+	return functionScope{}, false
+}
+
+// controlStatementRe matches the lines starting with a statement keyword, whose calls aren't definitions
+var controlStatementRe = regexp.MustCompile(`^\s*(?:if|else|for|foreach|while|do|switch|case|return|throw|new|await|yield|typeof|delete|catch|when|match|guard)\b`)
+
+// bracedDefinitionRe returns the pattern of the definition of the named function in a C-like language:
+// the name after a definition keyword (function, func, fun, fn), after a return type and modifiers, at the
+// start of a line (a JavaScript method), or assigned a function or an arrow function. A call like
+// `if name(x) {` also looks like a definition with a return type, controlStatementRe rules them out.
+func bracedDefinitionRe(name string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(name)
+	return regexp.MustCompile(`^\s*(?:` +
+		`(?:(?:function\*?|func|fun|fn)\s+|[\w$:.<>\[\],?]+[\s*&]+)*(?:\w+::)*` + quoted + `\s*(?:<[^>]*>)?\s*\(` +
+		`|(?:(?:export|const|let|var|val)\s+)*` + quoted + `\s*[:=]\s*(?:async\s*)?(?:function\b[^(]*)?\(` +
+		`)`)
+}
+
+// bracedFunctionScope finds a definition whose body is delimited by the braces following it.
+// Braces in strings and comments aren't accounted for, which is good enough for a review scope.
+func bracedFunctionScope(src string, definition *regexp.Regexp) (functionScope, bool) {
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		if !definition.MatchString(line) || controlStatementRe.MatchString(line) {
+			continue
+		}
+		depth := 0
+		opened := false
+	body:
+		for j := i; j < len(lines); j++ {
+			for _, r := range lines[j] {
+				switch r {
+				case '{':
+					depth++
+					opened = true
+				case '}':
+					depth--
+				case ';':
+					if !opened {
+						// a declaration or a call, not a definition
+						break body
+					}
+				}
+				if opened && depth == 0 {
+					return functionScope{Start: i + 1, End: j + 1}, true
+				}
+			}
+		}
+	}
+	return functionScope{}, false
+}
+
+// hunksInScope returns the patch with only the hunks whose new side overlaps the scope
+func hunksInScope(patch string, scope functionScope) string {
+	var kept []string
+	var hunk []string
+	inScope := false
+	flush := func() {
+		if inScope {
+			kept = append(kept, hunk...)
+		}
+	}
+	for _, line := range strings.Split(patch, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			flush()
+			hunk = nil
+			inScope = false
+			for _, h := range parseHunks("", line) {
+				inScope = h.NewStart <= scope.End && h.NewStart+h.NewCount-1 >= scope.Start
+			}
+		}
+		hunk = append(hunk, line)
+	}
+	flush()
+	return strings.Join(kept, "\n")
+}
+
+// scopeToFunction keeps the files defining the named function at the PR's head, with only the hunks
+// touching it. It returns no scopes when the function couldn't be found in any changed file.
+func scopeToFunction(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest, files []*github.CommitFile, name string) ([]*github.CommitFile, map[string]functionScope) {
+	scopes := make(map[string]functionScope)
+	var scoped []*github.CommitFile
+	for _, file := range files {
+		if file.Patch == nil || file.GetStatus() == "removed" {
+			continue
+		}
+		content, _, _, err := client.Repositories.GetContents(ctx, owner, repo, file.GetFilename(), &github.RepositoryContentGetOptions{Ref: pr.GetHead().GetSHA()})
+		if err != nil || content == nil {
+			logf(slog.LevelError, "Error fetching %s to find %s: %v\n", file.GetFilename(), name, err)
+			continue
+		}
+		src, err := content.GetContent()
+		if err != nil {
+			continue
+		}
+		scope, ok := findFunctionScope(file.GetFilename(), src, name)
+		if !ok {
+			continue
+		}
+		patch := hunksInScope(file.GetPatch(), scope)
+		if patch == "" {
+			continue
+		}
+		logf(slog.LevelDebug, "Found %s in %s, lines %d-%d\n", name, file.GetFilename(), scope.Start, scope.End)
+		f := *file
+		f.Patch = github.String(patch)
+		scoped = append(scoped, &f)
+		scopes[file.GetFilename()] = scope
+	}
+	return scoped, scopes
+}
+
+// commentsInScope drops the comments outside the function scopes
+func commentsInScope(comments []*github.DraftReviewComment, scopes map[string]functionScope) []*github.DraftReviewComment {
+	var kept []*github.DraftReviewComment
+	for _, comment := range comments {
+		scope, ok := scopes[comment.GetPath()]
+		if ok && comment.GetSide() != "LEFT" && comment.GetLine() >= scope.Start && comment.GetLine() <= scope.End {
+			kept = append(kept, comment)
+			continue
+		}
+		if ok && comment.GetSide() == "LEFT" {
+			// removed lines have no position in the new function, they are kept when in one of its hunks
+			kept = append(kept, comment)
+			continue
+		}
+		logf(slog.LevelDebug, "Dropping comment on %s:%d, outside the reviewed function.\n", comment.GetPath(), comment.GetLine())
+	}
+	return kept
+}
+
+// functionScopeNote tells the reader the review only covers one function
+func functionScopeNote(name string, scopes map[string]functionScope) string {
+	var locations []string
+	for filename, scope := range scopes {
+		locations = append(locations, fmt.Sprintf("`%s:%d-%d`", filename, scope.Start, scope.End))
+	}
+	return fmt.Sprintf("> This review only covers the changes to `%s` (%s).", name, strings.Join(locations, ", "))
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestFindFunctionScopeSkipsCallSites(t *testing.T) {
+	tests := []struct {
+		filename, src string
+		want          functionScope
+	}{
+		{"app.swift", "func run() {\n    if validate(x) {\n        go()\n    }\n}\n\nfunc validate(_ x: Int) -> Bool {\n    return x > 0\n}\n", functionScope{7, 9}},
+		{"lib.rs", "fn main() {\n    let ok = validate(1);\n}\n\npub fn validate(x: i32) -> bool {\n    x > 0\n}\n", functionScope{5, 7}},
+		{"Main.java", "class Main {\n  void run() {\n    while (validate(x)) {\n    }\n  }\n  private static boolean validate(int x) {\n    return x > 0;\n  }\n}\n", functionScope{6, 8}},
+		{"main.cpp", "int main() {\n  return validate(1) ? 0 : 1;\n}\nbool Checker::validate(int x) {\n  return x > 0;\n}\n", functionScope{4, 6}},
+		{"app.js", "run(() => {\n  if (ok) { validate(1); }\n});\nexport async function validate(x) {\n  return x > 0;\n}\n", functionScope{4, 6}},
+		{"app.ts", "const validate = async (x: number) => {\n  return x > 0;\n};\n", functionScope{1, 3}},
+		{"app.js", "class Form {\n  validate(x) {\n    return x > 0;\n  }\n}\n", functionScope{2, 4}},
+	}
+	for _, test := range tests {
+		got, ok := findFunctionScope(test.filename, test.src, "validate")
+		if !ok || got != test.want {
+			t.Errorf("findFunctionScope(%s) = %v, %v, want %v", test.filename, got, ok, test.want)
+		}
+	}
+
+	if scope, ok := findFunctionScope("app.swift", "func run() {\n    if validate(x) {\n        go()\n    }\n}\n", "validate"); ok {
+		t.Errorf("found a definition at %v in a file that only calls the function", scope)
+	}
+}
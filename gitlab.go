@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+	"github.com/xanzy/go-gitlab"
+)
+
+// defaultGitLabURL is the GitLab instance merge requests are reviewed on when -gitlab-url isn't set
+const defaultGitLabURL = "https://gitlab.com"
+
+// gitlabForge is the forge of the merge requests on a GitLab instance. The owner is the group (or the user)
+// of the project, and the number is the merge request's IID.
+type gitlabForge struct {
+	client *gitlab.Client
+}
+
+// newGitLabForge returns the forge of the GitLab instance at baseURL, e.g. https://gitlab.example.com.
+// Rate-limited and failed calls are retried by the client, up to -max-retries times.
+func newGitLabForge(baseURL, token string) (*gitlabForge, error) {
+	if token == "" {
+		return nil, errors.New("GITLAB_TOKEN is not set")
+	}
+	client, err := gitlab.NewClient(token, gitlab.WithBaseURL(baseURL), gitlab.WithCustomRetryMax(rateLimitRetry.Retries))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitLab URL %q: %w", baseURL, err)
+	}
+	return &gitlabForge{client: client}, nil
+}
+
+// projectID is the path of the project, which the API accepts in place of its numeric ID
+func projectID(owner, repo string) string {
+	return owner + "/" + repo
+}
+
+func (g *gitlabForge) PullRequest(ctx context.Context, owner, repo string, number int) (*github.PullRequest, error) {
+	mr, _, err := g.client.MergeRequests.GetMergeRequest(projectID(owner, repo), number, nil, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	pr := &github.PullRequest{
+		Number:  github.Int(mr.IID),
+		Title:   github.String(mr.Title),
+		Body:    github.String(mr.Description),
+		Draft:   github.Bool(mr.Draft),
+		HTMLURL: github.String(mr.WebURL),
+		User:    &github.User{},
+		Head:    &github.PullRequestBranch{SHA: github.String(mr.SHA), Ref: github.String(mr.SourceBranch)},
+		Base:    &github.PullRequestBranch{SHA: github.String(mr.DiffRefs.BaseSha), Ref: github.String(mr.TargetBranch)},
+	}
+	if mr.Author != nil {
+		pr.User.Login = github.String(mr.Author.Username)
+	}
+	return pr, nil
+}
+
+// Files rebuilds a unified diff from the merge request's diffs, walking all their pages
+func (g *gitlabForge) Files(ctx context.Context, owner, repo string, number int) ([]*github.CommitFile, error) {
+	var diff strings.Builder
+	opts := &gitlab.ListMergeRequestDiffsOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	for {
+		diffs, resp, err := g.client.MergeRequests.ListMergeRequestDiffs(projectID(owner, repo), number, opts, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range diffs {
+			fmt.Fprintf(&diff, "diff --git a/%s b/%s\n", d.OldPath, d.NewPath)
+			switch {
+			case d.NewFile:
+				fmt.Fprintf(&diff, "new file mode %s\n", d.BMode)
+			case d.DeletedFile:
+				fmt.Fprintf(&diff, "deleted file mode %s\n", d.AMode)
+			case d.RenamedFile:
+				fmt.Fprintf(&diff, "rename from %s\nrename to %s\n", d.OldPath, d.NewPath)
+			}
+			diff.WriteString(d.Diff)
+			if d.Diff != "" && !strings.HasSuffix(d.Diff, "\n") {
+				diff.WriteString("\n")
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return parseUnifiedDiff(diff.String()), nil
+}
+
+// Reviews returns the approvals of the merge request, GitLab has no other kind of review
+func (g *gitlabForge) Reviews(ctx context.Context, owner, repo string, number int) ([]*github.PullRequestReview, error) {
+	approvals, _, err := g.client.MergeRequestApprovals.GetConfiguration(projectID(owner, repo), number, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	var reviews []*github.PullRequestReview
+	for _, approval := range approvals.ApprovedBy {
+		if approval.User == nil {
+			continue
+		}
+		reviews = append(reviews, &github.PullRequestReview{
+			User:  &github.User{Login: github.String(approval.User.Username)},
+			State: github.String("APPROVED"),
+		})
+	}
+	return reviews, nil
+}
+
+// ChecksPassed reports whether the latest pipeline of the merge request's head didn't fail, and whether it's still running
+func (g *gitlabForge) ChecksPassed(ctx context.Context, owner, repo string, pr *github.PullRequest) (bool, []string, error) {
+	opts := &gitlab.ListProjectPipelinesOptions{SHA: gitlab.Ptr(pr.GetHead().GetSHA()), ListOptions: gitlab.ListOptions{PerPage: 1}}
+	pipelines, _, err := g.client.Pipelines.ListProjectPipelines(projectID(owner, repo), opts, gitlab.WithContext(ctx))
+	if err != nil {
+		return false, nil, err
+	}
+	if len(pipelines) == 0 {
+		return true, nil, nil
+	}
+	switch pipelines[0].Status {
+	case "failed":
+		return false, nil, nil
+	case "created", "waiting_for_resource", "preparing", "pending", "running", "scheduled":
+		return true, []string{"pipeline"}, nil
+	}
+	return true, nil, nil
+}
+
+// PostReview posts each comment as a discussion on its line and the review as a note, then approves
+// the merge request when the state is APPROVE. GitLab has no change requests, a REQUEST_CHANGES review
+// is only a note. Range comments are placed on their last line.
+func (g *gitlabForge) PostReview(ctx context.Context, owner, repo string, number int, review string, comments []*github.DraftReviewComment, files []*github.CommitFile, state string, opts postOptions) error {
+	pid := projectID(owner, repo)
+	mr, _, err := g.client.MergeRequests.GetMergeRequest(pid, number, nil, gitlab.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	oldPaths := make(map[string]string)
+	for _, file := range files {
+		oldPaths[file.GetFilename()] = file.GetFilename()
+		if file.PreviousFilename != nil {
+			oldPaths[file.GetFilename()] = file.GetPreviousFilename()
+		}
+	}
+
+	for _, comment := range markComments(comments) {
+		position := &gitlab.PositionOptions{
+			PositionType: gitlab.Ptr("text"),
+			BaseSHA:      gitlab.Ptr(mr.DiffRefs.BaseSha),
+			StartSHA:     gitlab.Ptr(mr.DiffRefs.StartSha),
+			HeadSHA:      gitlab.Ptr(mr.DiffRefs.HeadSha),
+			NewPath:      gitlab.Ptr(comment.GetPath()),
+			OldPath:      gitlab.Ptr(oldPaths[comment.GetPath()]),
+		}
+		if comment.GetSide() == "LEFT" {
+			position.OldLine = gitlab.Ptr(comment.GetLine())
+		} else {
+			position.NewLine = gitlab.Ptr(comment.GetLine())
+		}
+		discussion := &gitlab.CreateMergeRequestDiscussionOptions{Body: gitlab.Ptr(comment.GetBody()), Position: position}
+		_, _, err := g.client.Discussions.CreateMergeRequestDiscussion(pid, number, discussion, gitlab.WithContext(ctx))
+		if err != nil {
+			// discussions are posted one by one, a rejected one doesn't lose the others
+			logf(slog.LevelError, "Error posting the comment on %s:%d: %v\n", comment.GetPath(), comment.GetLine(), err)
+		}
+	}
+
+	note := &gitlab.CreateMergeRequestNoteOptions{Body: gitlab.Ptr(wrapReviewBody(review, number, opts))}
+	_, _, err = g.client.Notes.CreateMergeRequestNote(pid, number, note, gitlab.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	if state == "APPROVE" {
+		// the SHA makes GitLab refuse the approval when the merge request moved since it was reviewed
+		_, _, err = g.client.MergeRequestApprovals.ApproveMergeRequest(pid, number, &gitlab.ApproveMergeRequestOptions{SHA: gitlab.Ptr(mr.SHA)}, gitlab.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("error approving the merge request: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// newTestGitLabForge returns a forge sending its requests to a test server serving handler
+func newTestGitLabForge(t *testing.T, handler http.Handler) *gitlabForge {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	forge, err := newGitLabForge(server.URL, "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return forge
+}
+
+func TestGitLabFilesWalksAllPages(t *testing.T) {
+	pages := map[string]string{
+		"1": `[{"old_path":"main.go","new_path":"main.go","a_mode":"100644","b_mode":"100644","diff":"@@ -1,2 +1,2 @@\n package main\n-var a = 1\n+var a = 2\n"}]`,
+		"2": `[{"old_path":"old.go","new_path":"new.go","renamed_file":true,"a_mode":"100644","b_mode":"100644","diff":"@@ -3 +3,2 @@\n x := 1\n+y := 2"},` +
+			`{"old_path":"docs/new.md","new_path":"docs/new.md","new_file":true,"a_mode":"0","b_mode":"100644","diff":"@@ -0,0 +1 @@\n+# Docs\n"}]`,
+	}
+	forge := newTestGitLabForge(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "token" {
+			t.Errorf("request without the token")
+		}
+		if r.URL.EscapedPath() != "/api/v4/projects/group%2Fapi/merge_requests/42/diffs" {
+			t.Errorf("unexpected request to %s", r.URL.EscapedPath())
+		}
+		page := r.URL.Query().Get("page")
+		if page == "" || page == "1" {
+			page = "1"
+			w.Header().Set("X-Next-Page", "2")
+		}
+		fmt.Fprint(w, pages[page])
+	}))
+
+	files, err := forge.Files(context.Background(), "group", "api", 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("got %d files, want the 3 files of both pages", len(files))
+	}
+	want := []struct {
+		name, status, previous string
+		additions, deletions   int
+	}{
+		{"main.go", "modified", "", 1, 1},
+		{"new.go", "renamed", "old.go", 1, 0},
+		{"docs/new.md", "added", "", 1, 0},
+	}
+	for i, w := range want {
+		file := files[i]
+		if file.GetFilename() != w.name || file.GetStatus() != w.status || file.GetPreviousFilename() != w.previous ||
+			file.GetAdditions() != w.additions || file.GetDeletions() != w.deletions {
+			t.Errorf("file %d is %s (%s, from %q, +%d -%d), want %s (%s, from %q, +%d -%d)", i,
+				file.GetFilename(), file.GetStatus(), file.GetPreviousFilename(), file.GetAdditions(), file.GetDeletions(),
+				w.name, w.status, w.previous, w.additions, w.deletions)
+		}
+	}
+	if patch := files[1].GetPatch(); patch != "@@ -3 +3,2 @@\n x := 1\n+y := 2" {
+		t.Errorf("got patch %q for the diff without a final newline", patch)
+	}
+}
+
+func TestGitLabPostReviewPositions(t *testing.T) {
+	var mu sync.Mutex
+	var discussions []map[string]any
+	var notes, approvals []string
+	forge := newTestGitLabForge(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path := strings.TrimPrefix(r.URL.EscapedPath(), "/api/v4/projects/group%2Fapi/merge_requests/42")
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Method == "GET" && path == "":
+			fmt.Fprint(w, `{"iid":42,"sha":"head1","diff_refs":{"base_sha":"base1","start_sha":"start1","head_sha":"head1"}}`)
+		case r.Method == "POST" && path == "/discussions":
+			var discussion map[string]any
+			if err := json.Unmarshal(body, &discussion); err != nil {
+				t.Errorf("invalid discussion %s: %v", body, err)
+			}
+			discussions = append(discussions, discussion)
+			fmt.Fprint(w, `{}`)
+		case r.Method == "POST" && path == "/notes":
+			notes = append(notes, string(body))
+			fmt.Fprint(w, `{}`)
+		case r.Method == "POST" && path == "/approve":
+			var approval struct {
+				SHA string `json:"sha"`
+			}
+			if err := json.Unmarshal(body, &approval); err != nil {
+				t.Errorf("invalid approval %s: %v", body, err)
+			}
+			approvals = append(approvals, approval.SHA)
+			fmt.Fprint(w, `{}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+
+	files := []*github.CommitFile{
+		{Filename: github.String("main.go")},
+		{Filename: github.String("new.go"), PreviousFilename: github.String("old.go")},
+	}
+	comments := []*github.DraftReviewComment{
+		{Path: github.String("main.go"), Line: github.Int(7), Side: github.String("RIGHT"), Body: github.String("[minor] Added line")},
+		{Path: github.String("new.go"), Line: github.Int(3), Side: github.String("LEFT"), Body: github.String("[nit] Removed line")},
+		{Path: github.String("main.go"), StartLine: github.Int(10), Line: github.Int(12), Side: github.String("RIGHT"), Body: github.String("[major] Range")},
+	}
+	err := forge.PostReview(context.Background(), "group", "api", 42, "Looks good.", comments, files, "APPROVE", postOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(discussions) != 3 {
+		t.Fatalf("got %d discussions, want one per comment", len(discussions))
+	}
+	want := []map[string]any{
+		{"new_path": "main.go", "old_path": "main.go", "new_line": 7.0},
+		{"new_path": "new.go", "old_path": "old.go", "old_line": 3.0},
+		{"new_path": "main.go", "old_path": "main.go", "new_line": 12.0},
+	}
+	for i, fields := range want {
+		position, _ := discussions[i]["position"].(map[string]any)
+		for key, value := range fields {
+			if position[key] != value {
+				t.Errorf("discussion %d has %s %v, want %v", i, key, position[key], value)
+			}
+		}
+		if position["base_sha"] != "base1" || position["start_sha"] != "start1" || position["head_sha"] != "head1" || position["position_type"] != "text" {
+			t.Errorf("discussion %d has position %v, want the merge request's diff refs", i, position)
+		}
+		if _, ok := position["old_line"]; ok && fields["new_line"] != nil {
+			t.Errorf("discussion %d on an added line also has an old_line", i)
+		}
+	}
+	if len(notes) != 1 || !strings.Contains(notes[0], "Looks good.") {
+		t.Errorf("got notes %v, want the review", notes)
+	}
+	if len(approvals) != 1 || approvals[0] != "head1" {
+		t.Errorf("got approvals %v, want one at the reviewed head", approvals)
+	}
+}
+
+func TestGitLabRetriesRateLimitedCalls(t *testing.T) {
+	calls := 0
+	forge := newTestGitLabForge(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"iid":42,"title":"Fix the build"}`)
+	}))
+
+	pr, err := forge.PullRequest(context.Background(), "group", "api", 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 || pr.GetTitle() != "Fix the build" {
+		t.Errorf("got %q after %d calls, want the merge request after one retry", pr.GetTitle(), calls)
+	}
+}
@@ -3,16 +3,28 @@ module github.com/nvrwhr/gh-pr-reviewer
 go 1.22.5
 
 require (
+	github.com/bmatcuk/doublestar/v4 v4.6.1
+	github.com/bradleyfalzon/ghinstallation/v2 v2.7.0
 	github.com/google/go-github/v55 v55.0.0
 	github.com/joho/godotenv v1.5.1
+	github.com/pkoukk/tiktoken-go v0.1.7
 	github.com/sashabaranov/go-openai v1.28.1
+	github.com/xanzy/go-gitlab v0.115.0
+	github.com/yuin/goldmark v1.7.8
 	golang.org/x/oauth2 v0.22.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/ProtonMail/go-crypto v0.0.0-20230217124315-7d5c6f04bbb8 // indirect
 	github.com/cloudflare/circl v1.3.3 // indirect
+	github.com/dlclark/regexp2 v1.10.0 // indirect
+	github.com/golang-jwt/jwt/v4 v4.5.0 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
+	github.com/google/uuid v1.3.0 // indirect
+	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
+	github.com/hashicorp/go-retryablehttp v0.7.7 // indirect
 	golang.org/x/crypto v0.12.0 // indirect
-	golang.org/x/sys v0.11.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	golang.org/x/time v0.3.0 // indirect
 )
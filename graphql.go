@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// graphQLResponse is the envelope returned by the GitHub GraphQL API
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphQL runs a GraphQL query or mutation using the REST client's authenticated transport
+// and decodes the "data" field into out
+func graphQL(ctx context.Context, client *github.Client, query string, variables map[string]interface{}, out interface{}) error {
+	req, err := client.NewRequest("POST", graphQLEndpoint(client), map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	var resp graphQLResponse
+	_, err = client.Do(ctx, req, &resp)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Errors) > 0 {
+		var messages []string
+		for _, e := range resp.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("graphql error: %s", strings.Join(messages, "; "))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+// reviewThread is a PR review thread with its first comment
+type reviewThread struct {
+	ID         string `json:"id"`
+	IsResolved bool   `json:"isResolved"`
+	IsOutdated bool   `json:"isOutdated"`
+	Path       string `json:"path"`
+	Comments   struct {
+		Nodes []struct {
+			Body string `json:"body"`
+		} `json:"nodes"`
+	} `json:"comments"`
+}
+
+const reviewThreadsQuery = `
+query($owner: String!, $repo: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          id
+          isResolved
+          isOutdated
+          path
+          comments(first: 1) { nodes { body } }
+        }
+      }
+    }
+  }
+}`
+
+const resolveReviewThreadMutation = `
+mutation($threadId: ID!) {
+  resolveReviewThread(input: {threadId: $threadId}) {
+    thread { id }
+  }
+}`
+
+// listReviewThreads fetches all review threads of a PR
+func listReviewThreads(ctx context.Context, client *github.Client, owner, repo string, prNumber int) ([]reviewThread, error) {
+	var threads []reviewThread
+	var cursor *string
+	for {
+		var data struct {
+			Repository struct {
+				PullRequest struct {
+					ReviewThreads struct {
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+						Nodes []reviewThread `json:"nodes"`
+					} `json:"reviewThreads"`
+				} `json:"pullRequest"`
+			} `json:"repository"`
+		}
+		err := graphQL(ctx, client, reviewThreadsQuery, map[string]interface{}{
+			"owner":  owner,
+			"repo":   repo,
+			"number": prNumber,
+			"cursor": cursor,
+		}, &data)
+		if err != nil {
+			return nil, err
+		}
+
+		page := data.Repository.PullRequest.ReviewThreads
+		threads = append(threads, page.Nodes...)
+		if !page.PageInfo.HasNextPage {
+			break
+		}
+		cursor = &page.PageInfo.EndCursor
+	}
+	return threads, nil
+}
+
+// resolveOutdatedThreads resolves the unresolved threads started by this tool whose target lines
+// have changed since the comment was posted, which usually means the issue was fixed
+func resolveOutdatedThreads(ctx context.Context, client *github.Client, owner, repo string, prNumber int) (int, error) {
+	threads, err := listReviewThreads(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return 0, err
+	}
+
+	resolved := 0
+	for _, thread := range threads {
+		if thread.IsResolved || !thread.IsOutdated || len(thread.Comments.Nodes) == 0 {
+			continue
+		}
+		if !strings.Contains(thread.Comments.Nodes[0].Body, commentMarker) {
+			continue
+		}
+
+		err := graphQL(ctx, client, resolveReviewThreadMutation, map[string]interface{}{
+			"threadId": thread.ID,
+		}, nil)
+		if err != nil {
+			return resolved, fmt.Errorf("error resolving thread on %s: %w", thread.Path, err)
+		}
+		resolved++
+	}
+	return resolved, nil
+}
+
+// prSnapshot holds everything the review needs about a PR, fetched in as few calls as possible
+type prSnapshot struct {
+	PullRequest   *github.PullRequest
+	Viewer        string
+	FailedChecks  []string
+	PendingChecks []string
+	Files         []*github.CommitFile
+	PendingReview *github.PullRequestReview
+}
+
+const pullRequestQuery = `
+query($owner: String!, $repo: String!, $number: Int!) {
+  viewer { login }
+  repository(owner: $owner, name: $repo) {
+    url
+    pullRequest(number: $number) {
+      number
+      title
+      body
+      url
+      isDraft
+      author { login }
+      headRefOid
+      baseRefName
+      baseRefOid
+      baseRepository { owner { login } name }
+      reviews(states: [PENDING], first: 1) {
+        nodes { databaseId state }
+      }
+      commits(last: 1) {
+        nodes {
+          commit {
+            statusCheckRollup {
+              contexts(first: 100) {
+                nodes {
+                  ... on CheckRun { name status conclusion }
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// fetchPullRequestGraphQL fetches the PR, the viewer, the checks and the pending review in a single
+// GraphQL query. The file patches aren't available in GraphQL, so they come from the PR's raw diff.
+func fetchPullRequestGraphQL(ctx context.Context, client *github.Client, owner, repo string, prNumber int) (*prSnapshot, error) {
+	var data struct {
+		Viewer struct {
+			Login string `json:"login"`
+		} `json:"viewer"`
+		Repository struct {
+			URL         string `json:"url"`
+			PullRequest struct {
+				Number  int    `json:"number"`
+				Title   string `json:"title"`
+				Body    string `json:"body"`
+				URL     string `json:"url"`
+				IsDraft bool   `json:"isDraft"`
+				Author  struct {
+					Login string `json:"login"`
+				} `json:"author"`
+				HeadRefOid     string `json:"headRefOid"`
+				BaseRefName    string `json:"baseRefName"`
+				BaseRefOid     string `json:"baseRefOid"`
+				BaseRepository struct {
+					Owner struct {
+						Login string `json:"login"`
+					} `json:"owner"`
+					Name string `json:"name"`
+				} `json:"baseRepository"`
+				Reviews struct {
+					Nodes []struct {
+						DatabaseID int64  `json:"databaseId"`
+						State      string `json:"state"`
+					} `json:"nodes"`
+				} `json:"reviews"`
+				Commits struct {
+					Nodes []struct {
+						Commit struct {
+							StatusCheckRollup *struct {
+								Contexts struct {
+									Nodes []struct {
+										Name       string `json:"name"`
+										Status     string `json:"status"`
+										Conclusion string `json:"conclusion"`
+									} `json:"nodes"`
+								} `json:"contexts"`
+							} `json:"statusCheckRollup"`
+						} `json:"commit"`
+					} `json:"nodes"`
+				} `json:"commits"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	err := graphQL(ctx, client, pullRequestQuery, map[string]interface{}{
+		"owner":  owner,
+		"repo":   repo,
+		"number": prNumber,
+	}, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	p := data.Repository.PullRequest
+	snapshot := &prSnapshot{
+		PullRequest: &github.PullRequest{
+			Number:  github.Int(p.Number),
+			Title:   github.String(p.Title),
+			Body:    github.String(p.Body),
+			HTMLURL: github.String(p.URL),
+			Draft:   github.Bool(p.IsDraft),
+			User:    &github.User{Login: github.String(p.Author.Login)},
+			Head:    &github.PullRequestBranch{SHA: github.String(p.HeadRefOid)},
+			Base: &github.PullRequestBranch{
+				Ref: github.String(p.BaseRefName),
+				SHA: github.String(p.BaseRefOid),
+				Repo: &github.Repository{
+					Owner:   &github.User{Login: github.String(p.BaseRepository.Owner.Login)},
+					Name:    github.String(p.BaseRepository.Name),
+					HTMLURL: github.String(data.Repository.URL),
+				},
+			},
+		},
+		Viewer: data.Viewer.Login,
+	}
+
+	// Whether the failed checks block the approval depends on the required checks
+	for _, commit := range p.Commits.Nodes {
+		if commit.Commit.StatusCheckRollup == nil {
+			continue
+		}
+		for _, check := range commit.Commit.StatusCheckRollup.Contexts.Nodes {
+			if check.Conclusion == "FAILURE" {
+				snapshot.FailedChecks = append(snapshot.FailedChecks, check.Name)
+			} else if check.Name != "" && check.Status != "COMPLETED" {
+				// status contexts come back as empty nodes, only check runs are listed
+				snapshot.PendingChecks = append(snapshot.PendingChecks, check.Name)
+			}
+		}
+	}
+
+	for _, review := range p.Reviews.Nodes {
+		snapshot.PendingReview = &github.PullRequestReview{
+			ID:    github.Int64(review.DatabaseID),
+			State: github.String(review.State),
+		}
+	}
+
+	diff, _, err := client.PullRequests.GetRaw(ctx, owner, repo, prNumber, github.RawOptions{Type: github.Diff})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching PR diff: %w", err)
+	}
+	snapshot.Files = parseUnifiedDiff(diff)
+
+	return snapshot, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestFetchPullRequestGraphQLFillsBase(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/graphql":
+			fmt.Fprint(w, `{"data":{"viewer":{"login":"bot"},"repository":{"url":"https://github.com/octocat/hello","pullRequest":{`+
+				`"number":7,"title":"Fix","headRefOid":"head1","baseRefName":"main","baseRefOid":"base1",`+
+				`"baseRepository":{"owner":{"login":"octocat"},"name":"hello"}}}}}`)
+		case "/repos/octocat/hello/pulls/7":
+			fmt.Fprint(w, "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-a\n+b\n")
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+
+	snapshot, err := fetchPullRequestGraphQL(context.Background(), client, "octocat", "hello", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	base := snapshot.PullRequest.GetBase()
+	if base.GetSHA() != "base1" || base.GetRef() != "main" {
+		t.Errorf("got base %s at %s, want main at base1", base.GetRef(), base.GetSHA())
+	}
+	if base.GetRepo().GetOwner().GetLogin() != "octocat" || base.GetRepo().GetName() != "hello" {
+		t.Errorf("got base repository %s/%s, want octocat/hello", base.GetRepo().GetOwner().GetLogin(), base.GetRepo().GetName())
+	}
+	if len(snapshot.Files) != 1 {
+		t.Errorf("got %d files, want the diff's file", len(snapshot.Files))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// diffHunk is a hunk of a file's patch with a stable ID derived from its content, so the model
+// can reference "<id>:<n>" (the n-th line of the hunk's new side) instead of absolute line numbers
+type diffHunk struct {
+	ID       string
+	NewStart int
+	NewCount int
+}
+
+// parseHunks splits a patch into hunks. The ID hashes the file name and the hunk's lines without
+// the "@@" header, so it doesn't change when earlier hunks shift the line numbers.
+func parseHunks(filename, patch string) []diffHunk {
+	var hunks []diffHunk
+	var body []string
+	seen := make(map[string]int)
+
+	flush := func() {
+		if len(hunks) == 0 {
+			return
+		}
+		sum := sha256.Sum256([]byte(filename + "\n" + strings.Join(body, "\n")))
+		id := "h" + hex.EncodeToString(sum[:3])
+		// identical hunks in the same file get a suffix
+		seen[id]++
+		if seen[id] > 1 {
+			id = fmt.Sprintf("%s-%d", id, seen[id])
+		}
+		hunks[len(hunks)-1].ID = id
+	}
+
+	for _, line := range strings.Split(patch, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			flush()
+			body = nil
+			hunk := diffHunk{NewCount: 1}
+			// @@ -1,3 +4,5 @@ means the hunk covers lines 4 to 8 of the new file
+			parts := strings.Split(line, " ")
+			if len(parts) >= 3 {
+				newInfo := strings.Split(strings.TrimPrefix(parts[2], "+"), ",")
+				hunk.NewStart, _ = strconv.Atoi(newInfo[0])
+				if len(newInfo) > 1 {
+					hunk.NewCount, _ = strconv.Atoi(newInfo[1])
+				}
+			}
+			hunks = append(hunks, hunk)
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+	return hunks
+}
+
+// resolveHunkLine converts the n-th new-side line of the hunk with the given ID to a new-file line number
+func resolveHunkLine(hunks []diffHunk, id string, n int) (int, bool) {
+	for _, hunk := range hunks {
+		if hunk.ID == id {
+			if n < 1 || n > hunk.NewCount {
+				return 0, false
+			}
+			return hunk.NewStart + n - 1, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// defaultSeverityIcons is the default icon put in front of the comments of each severity
+const defaultSeverityIcons = "blocker=🔴,major=🟠,minor=🟡,nit=🔵"
+
+// parseSeverityIcons parses a mapping like "blocker=🔴,nit=🔵". Severities missing from the value
+// keep their default icon, and an empty value disables the icons.
+func parseSeverityIcons(value string) (map[string]string, error) {
+	icons := make(map[string]string)
+	if strings.TrimSpace(value) == "" {
+		return icons, nil
+	}
+	for _, entry := range strings.Split(defaultSeverityIcons+","+value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		severity, icon, ok := strings.Cut(entry, "=")
+		severity, icon = strings.ToLower(strings.TrimSpace(severity)), strings.TrimSpace(icon)
+		if !ok || icon == "" || strings.ContainsAny(icon, " [") {
+			return nil, fmt.Errorf("invalid entry %q, expected <severity>=<icon>", entry)
+		}
+		if !isSeverity(severity) {
+			return nil, fmt.Errorf("unknown severity %q, expected one of %s", severity, strings.Join(severities, ", "))
+		}
+		icons[severity] = icon
+	}
+	return icons, nil
+}
+
+// addSeverityIcons puts the icon of their severity in front of the tagged comments
+func addSeverityIcons(comments []*github.DraftReviewComment, icons map[string]string) {
+	for _, comment := range comments {
+		if icon := icons[commentSeverity(comment.GetBody())]; icon != "" {
+			comment.Body = github.String(icon + " " + comment.GetBody())
+		}
+	}
+}
+
+// severityLegend renders the one-line legend of the icons added to the review summary
+func severityLegend(icons map[string]string) string {
+	var entries []string
+	for _, severity := range severities {
+		if icon := icons[severity]; icon != "" {
+			entries = append(entries, icon+" "+severity)
+		}
+	}
+	if len(entries) == 0 {
+		return ""
+	}
+	return "Severity: " + strings.Join(entries, " · ")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// loadIgnorePatterns reads the regexes of comments to suppress from a file, one per line.
+// Blank lines and lines starting with # are ignored.
+func loadIgnorePatterns(path string) ([]*regexp.Regexp, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ignore-comments file: %w", err)
+	}
+
+	var patterns []*regexp.Regexp
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern on line %d of the ignore-comments file: %w", i+1, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// suppressIgnoredComments drops the comments whose body matches one of the patterns
+func suppressIgnoredComments(comments []*github.DraftReviewComment, patterns []*regexp.Regexp) []*github.DraftReviewComment {
+	if len(patterns) == 0 {
+		return comments
+	}
+
+	var kept []*github.DraftReviewComment
+	for _, comment := range comments {
+		suppressed := false
+		for _, re := range patterns {
+			if re.MatchString(comment.GetBody()) {
+				logf(slog.LevelDebug, "Suppressed comment on %s:%d matching %q: %s\n", comment.GetPath(), comment.GetLine(), re.String(), comment.GetBody())
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, comment)
+		}
+	}
+	return kept
+}
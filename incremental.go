@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// filesChangedSince splits the PR's files into those the commits since the previous review touched
+// and those they didn't. The PR's own patches are kept, so the comments still target the PR's diff.
+func filesChangedSince(ctx context.Context, client *github.Client, owner, repo string, files []*github.CommitFile, previousSHA, headSHA string) (changed []*github.CommitFile, unchanged []string, err error) {
+	touched := make(map[string]bool)
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		var comparison *github.CommitsComparison
+		var resp *github.Response
+		err := withRateLimitRetry(ctx, func() (err error) {
+			comparison, resp, err = client.Repositories.CompareCommits(ctx, owner, repo, previousSHA, headSHA, opts)
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, file := range comparison.Files {
+			touched[file.GetFilename()] = true
+			// a file renamed since is new to the PR under its new name
+			if file.GetPreviousFilename() != "" {
+				touched[file.GetPreviousFilename()] = true
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	for _, file := range files {
+		if touched[file.GetFilename()] {
+			changed = append(changed, file)
+		} else {
+			unchanged = append(unchanged, file.GetFilename())
+		}
+	}
+	logf(slog.LevelInfo, "Reviewing the %d files changed since %s, skipping %d unchanged files.\n", len(changed), previousSHA, len(unchanged))
+	return changed, unchanged, nil
+}
+
+// untouchedComments returns the previous review's comments on the files the new commits didn't touch,
+// their lines haven't moved since
+func untouchedComments(previous *SavedReview, untouched []string) []*github.DraftReviewComment {
+	isUntouched := make(map[string]bool)
+	for _, name := range untouched {
+		isUntouched[name] = true
+	}
+
+	var comments []*github.DraftReviewComment
+	for _, comment := range previous.ReviewComments {
+		if isUntouched[comment.GetPath()] {
+			comments = append(comments, comment)
+		}
+	}
+	return comments
+}
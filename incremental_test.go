@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+)
+
+func TestUntouchedComments(t *testing.T) {
+	previous := &SavedReview{ReviewComments: []*github.DraftReviewComment{
+		{Path: github.String("a.go"), Line: github.Int(3), Body: github.String("[major] Leak")},
+		{Path: github.String("b.go"), Line: github.Int(5), Body: github.String("[minor] Name")},
+	}}
+
+	got := untouchedComments(previous, []string{"b.go"})
+	if len(got) != 1 || got[0].GetPath() != "b.go" {
+		t.Errorf("got %d comments, want the one on the untouched b.go", len(got))
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// maxLinkedIssues caps how many of the issues the PR references are sent to the model
+const maxLinkedIssues = 5
+
+// maxIssueBodyLength caps how much of an issue's description is sent to the model
+const maxIssueBodyLength = 4000
+
+// linkedIssueRe matches the closing keywords GitHub links issues with, e.g. "Fixes #123". References
+// to issues of other repositories (owner/repo#123) don't match.
+var linkedIssueRe = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?):?\s+#(\d+)\b`)
+
+// linkedIssueNumbers returns the issues the PR description closes, in order and without duplicates
+func linkedIssueNumbers(body string) []int {
+	var numbers []int
+	seen := make(map[int]bool)
+	for _, matches := range linkedIssueRe.FindAllStringSubmatch(body, -1) {
+		number, err := strconv.Atoi(matches[1])
+		if err != nil || seen[number] {
+			continue
+		}
+		seen[number] = true
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
+
+// linkedIssuesPrompt fetches the issues the PR closes and renders them for the prompt, so the model can
+// judge whether the changes address them. Issues that can't be fetched are skipped.
+func linkedIssuesPrompt(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest) string {
+	numbers := linkedIssueNumbers(pr.GetBody())
+	if len(numbers) > maxLinkedIssues {
+		logf(slog.LevelWarn, "The PR links %d issues, only the first %d are sent to the model.\n", len(numbers), maxLinkedIssues)
+		numbers = numbers[:maxLinkedIssues]
+	}
+
+	var issues []string
+	for _, number := range numbers {
+		var issue *github.Issue
+		err := withRateLimitRetry(ctx, func() (err error) {
+			issue, _, err = client.Issues.Get(ctx, owner, repo, number)
+			return err
+		})
+		if err != nil {
+			logf(slog.LevelError, "Error fetching the linked issue #%d, skipping it: %v\n", number, err)
+			continue
+		}
+		// PRs share the numbering of issues
+		if issue.IsPullRequest() {
+			continue
+		}
+		body := issue.GetBody()
+		if len(body) > maxIssueBodyLength {
+			body = body[:maxIssueBodyLength] + "\n[...]"
+		}
+		issues = append(issues, fmt.Sprintf("Issue #%d: %s\n%s", number, issue.GetTitle(), strings.TrimSpace(body)))
+	}
+	if len(issues) == 0 {
+		return ""
+	}
+	return "Linked Issues (the PR says it addresses them):\n\n" + strings.Join(issues, "\n\n") + "\n"
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logLevels maps the values of -log-level to their slog levels
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// setupLogging routes the logs to stderr through a text or JSON slog handler dropping the messages
+// below the level. The log package's messages are logged at info level.
+func setupLogging(level, format string) error {
+	minLevel, ok := logLevels[strings.ToLower(level)]
+	if !ok {
+		return fmt.Errorf("-log-level must be debug, info, warn or error, not %q", level)
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: minLevel}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, handlerOpts)
+	default:
+		return fmt.Errorf("-log-format must be text or json, not %q", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// logf logs a printf-style message at the level, the leveled counterpart of log.Printf
+func logf(level slog.Level, format string, args ...any) {
+	ctx := context.Background()
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+	slog.Log(ctx, level, strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+}
@@ -3,13 +3,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io/fs"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/go-github/v55/github"
 	"github.com/joho/godotenv"
@@ -17,51 +23,836 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// version is the tool version, set at build time with -ldflags "-X main.version=<version>"
+var version = "dev"
+
+// defaultModel is the OpenAI model used to generate reviews unless -model, -models or OPENAI_MODEL say otherwise
+const defaultModel = openai.GPT4oMini
+
+// commentMarker is appended to every review and comment posted by the tool so later runs can find them
+const commentMarker = "<!-- gh-pr-reviewer -->"
+
+// savedReviewVersion is the version of the saved review format, bumped on incompatible changes
+const savedReviewVersion = 1
+
 type SavedReview struct {
+	Version        int                          `json:"version"`
 	Review         string                       `json:"review"`
 	ReviewComments []*github.DraftReviewComment `json:"review_comments"`
 	Action         string                       `json:"action"`
+	// State is the review event the verdict resolved to, after the checks and the overrides
+	State string `json:"state,omitempty"`
+	// Owner and Repo tell the saved reviews of repositories with the same name apart
+	Owner    string      `json:"owner,omitempty"`
+	Repo     string      `json:"repo,omitempty"`
+	PRNumber int         `json:"pr_number,omitempty"`
+	HeadSHA  string      `json:"head_sha,omitempty"`
+	Files    []SavedFile `json:"files,omitempty"`
+	// PromptVersion identifies the prompt the review was generated with, see promptVersion
+	PromptVersion string `json:"prompt_version,omitempty"`
+}
+
+// runOptions holds the command-line settings shared by every PR reviewed in a run
+type runOptions struct {
+	DryRun               bool
+	ForceDry             bool
+	PreviewHTML          string
+	Format               string
+	ExportPatch          string
+	Selective            bool
+	Incremental          bool
+	SkipClean            bool
+	DiffMode             string
+	Completion           completionOptions
+	ReviewWIP            bool
+	Function             string
+	SummaryOnly          bool
+	MaxTokens            int
+	NoAI                 bool
+	ReviewsDir           string
+	BotLogin             string
+	CommentedCodeLines   int
+	CommentedCodeLangs   map[string]string
+	AssetLinks           bool
+	ChecklistBody        bool
+	SkipReviewedHeads    bool
+	DisableMarker        string
+	WIPPrefixes          []string
+	ChecklistPath        string
+	DocLinksPath         string
+	IgnoreCommentsPath   string
+	Prioritize           bool
+	LimitFiles           int
+	CoverageFile         string
+	FormattedLangs       string
+	NoInline             bool
+	GroupThemes          bool
+	GroupThemesMin       int
+	GistOverflow         bool
+	BodyHeader           string
+	BodyFooter           string
+	ShowProvenance       bool
+	PerCommitSummary     bool
+	TLDR                 bool
+	ReviewCommits        bool
+	CommitSpec           string
+	BlastRadius          bool
+	BlastRadiusThreshold int
+	UseGraphQL           bool
+	DismissStale         bool
+	SeverityEvents       map[string]string
+	SeverityIcons        map[string]string
+	DefaultAction        string
+	TestFastPathModel    string
+	EscalateTo           []string
+	EscalateSeverity     string
+	ApprovalPolicy       *approvalPolicy
+	IgnoreGlobs          []string
+	RepoOverrides        map[string]repoOverride
+	PromptTemplate       *template.Template
+	SystemPrompt         *template.Template
+	AutoResolve          bool
+	ReviewTimeout        time.Duration
+	RequiredChecks       []string
+	WaitForChecks        time.Duration
+	CommitContext        int
+	MaxComments          int
+}
+
+// reviewOutcome summarizes the review of a single PR for the batch report and the stats
+type reviewOutcome struct {
+	Owner    string
+	Repo     string
+	Number   int
+	Title    string
+	URL      string
+	HeadSHA  string
+	State    string
+	Comments int
+	Usage    openai.Usage
+	Cost     float64
+	Posted   bool
+	Err      error
+	// Review, Action, ReviewComments and ChecksPassed are the result printed by -output json
+	Review         string
+	Action         string
+	ReviewComments []*github.DraftReviewComment
+	ChecksPassed   *bool
 }
 
 func main() {
-	// Load environment variables from .env file
-	err := godotenv.Load()
-	if err != nil {
-		fmt.Println("Error loading .env file")
-		os.Exit(1)
-	}
+	// Load environment variables from .env file, the variables set in the environment are enough without it
+	envErr := godotenv.Load()
 
 	// Define command-line flags
 	owner := flag.String("owner", "", "Repository owner (e.g., 'octocat')")
 	repo := flag.String("repo", "", "Repository name (e.g., 'hello-world')")
 	prNumber := flag.Int("pr", 0, "Pull Request number (e.g., 42)")
+	prURL := flag.String("url", "", "URL of the PR to review (e.g. https://github.com/octocat/hello-world/pull/42), instead of -owner, -repo and -pr")
+	sweep := flag.Bool("sweep", false, "Review every open PR of the repository instead of a single one")
+	resumeSweep := flag.Bool("resume-sweep", false, "With -sweep, skip the PRs an interrupted sweep already completed and those already reviewed at their current head")
+	maxPRs := flag.Int("max-prs", 0, "With -sweep, review at most this many PRs (0 means no limit)")
+	maxCost := flag.Float64("max-cost", 0, "With -sweep, stop once the estimated model cost reaches this many USD (0 means no limit)")
+	batchReport := flag.String("batch-report", "", "Write a markdown report of every reviewed PR to this path")
+	focusComment := flag.Int64("focus-comment", 0, "ID of a review comment whose location the AI should analyze, replying in its thread")
+	ask := flag.String("ask", "", "Ask the AI a question about the PR's changes and print the answer without posting anything")
+	provider := flag.String("provider", "openai", "Model provider generating the reviews: openai (OPENAI_API_KEY) or anthropic (ANTHROPIC_API_KEY)")
+	model := flag.String("model", "", "Model generating the reviews (default $OPENAI_MODEL or "+defaultModel+", $ANTHROPIC_MODEL or "+defaultAnthropicModel+" with -provider=anthropic)")
+	models := flag.String("models", "", "Comma-separated, ordered chain of fallback models; the next one is tried when a model is rate limited or unavailable")
+	reviewWIP := flag.Bool("review-wip", false, "Review draft PRs and PRs whose title marks them as work in progress")
+	wipPrefixes := flag.String("wip-prefixes", defaultWIPPrefixes, "Comma-separated title prefixes marking a PR as work in progress")
+	disableMarker := flag.String("disable-marker", defaultDisableMarker, "Path of the file whose presence in the repository at the PR's head disables the review (empty disables the check)")
+	var excludeGlobs stringsFlag
+	flag.Var(&excludeGlobs, "exclude", "Glob of files to leave out of the review, e.g. '*.pb.go' or 'vendor/**' (repeatable)")
+	assetLinks := flag.Bool("asset-links", false, "Link the raw file of every added image from the asset changes section of the review")
+	function := flag.String("function", "", "Only review the changes to this function (Name or Type.Name), falling back to the whole PR when it isn't found")
+	summaryOnly := flag.Bool("summary-only", false, "Post only the review body, without asking for or posting inline comments")
+	checklistBody := flag.Bool("checklist-body", false, "When requesting changes, add a task list of the blocking comments to the review body")
 	dryRun := flag.Bool("dry", false, "Generate review without posting to GitHub")
 	forcedry := flag.Bool("forcedry", false, "Force overwrite the last local dry run review")
+	previewHTML := flag.String("preview-html", "", "In dry run, render the review as GitHub would display it to this HTML file")
+	failOnChanges := flag.Bool("fail-on-changes", false, "Exit with status 1 when the review requests changes (including because of failed checks), also in dry runs")
+	output := flag.String("output", "text", "Result output: text, or json to print a JSON object per reviewed PR to stdout, with the logs on stderr")
+	format := flag.String("format", "text", "Also write the comments to stdout in this format: text (nothing extra), rdjson or rdjsonl for reviewdog")
+	exportPatch := flag.String("export-patch", "", "Write the comments' suggestion blocks as a unified diff to this path, to apply with git apply")
+	diffMode := flag.String("diff-mode", "three-dot", "Diff to review: three-dot (changes since the merge base, like GitHub) or two-dot (base branch tip to head)")
+	incremental := flag.Bool("incremental", false, "Only review the files changed by the commits added since the previous saved review of the PR")
+	selective := flag.Bool("selective", false, "Only re-review the files whose patch changed since the previous saved review of the PR, carrying over its other comments")
+	skipClean := flag.Bool("skip-clean", false, "Skip the files the previous saved review of the PR found no issue in, when their patch hasn't changed")
+	checklistPath := flag.String("checklist", "", "Path to a file of checklist items the review must address (one per line)")
+	docLinksPath := flag.String("doc-links", "", "Path to a JSON file mapping issue categories to documentation URLs linked from comments")
+	ignoreComments := flag.String("ignore-comments", "", "Path to a file of regexes (one per line); comments matching any of them are never posted")
+	prioritize := flag.Bool("prioritize-files", false, "Review the most important files first (source before tests and docs, larger changes first)")
+	limitFiles := flag.Int("limit-files", 0, "Only review the first N files for a quick partial preview (0 reviews all files)")
+	coverageFile := flag.String("coverage-file", "", "Path to a Go cover profile or lcov file used to point out untested added lines")
+	formattedLangs := flag.String("formatted-langs", "go=gofmt", "Comma-separated <extension>=<formatter> list of languages whose formatting is enforced in CI")
+	noInline := flag.Bool("no-inline", false, "Post findings as a numbered list in the review body instead of inline comments")
+	groupThemesFlag := flag.Bool("group-themes", false, "Collapse similar comments repeated across the diff into a single bullet of the review body")
+	groupThemesMin := flag.Int("group-themes-min", 3, "Number of similar comments from which -group-themes collapses them")
+	gistOverflow := flag.Bool("gist-overflow", false, "Upload the full review to a secret gist when it exceeds GitHub's body size limit")
+	bodyHeaderFlag := flag.String("body-header", "", "Text, or @file, put above every posted review; {pr}, {date} and {reviewer} are replaced")
+	bodyFooterFlag := flag.String("body-footer", "", "Text, or @file, put below every posted review; {pr}, {date} and {reviewer} are replaced")
+	perCommitSummary := flag.Bool("per-commit-summary", false, "Add a one-line AI summary of each commit to the review")
+	reviewCommits := flag.Bool("review-commits", false, "Check the PR's commit messages against a convention (Conventional Commits by default)")
+	commitSpecFlag := flag.String("commit-spec", "", "Commit message convention for -review-commits, as text or @file")
+	tldr := flag.Bool("tldr", false, "Prepend a short AI-generated TL;DR to the review (one extra model call)")
+	blastRadius := flag.Bool("blast-radius", false, "Warn when a changed file is referenced by many other files of the repository (uses code search)")
+	blastRadiusThreshold := flag.Int("blast-radius-threshold", 10, "Number of referencing files from which -blast-radius warns about a changed file")
+	reviewsDir := flag.String("reviews-dir", "reviews", "Directory the reviews (and sweep progress) are saved to and loaded from; created when missing")
+	noAI := flag.Bool("no-ai", false, "Review with the built-in deterministic analyzers only, without calling a model")
+	commentedCodeLines := flag.Int("commented-code-lines", 5, "Flag added blocks of commented-out code with at least this many lines of code as minor comments (0 disables)")
+	commentedCodeLangs := flag.String("commented-code-langs", "", "Comma-separated file extensions scanned for commented-out code (empty scans every supported language)")
+	maxTokens := flag.Int("max-tokens", 0, "Token budget of a review request; larger PRs are reviewed in batches of files (0 uses the model's context window)")
+	seed := flag.Int("seed", -1, "Seed for reproducible sampling on models that support it (-1 means no seed)")
+	temperature := flag.Float64("temperature", defaultTemperature, "Sampling temperature of the model, from 0 (most deterministic) to 2 (1 with -provider=anthropic)")
+	maxResponseTokens := flag.Int("max-response-tokens", 0, "Maximum length of the model's response in tokens (0 uses the model's default, 4096 with -provider=anthropic)")
+	showProvenance := flag.Bool("show-provenance", false, "Append the model, provider, settings and tool version used to the review")
+	useGraphQL := flag.Bool("graphql", false, "Fetch the PR, checks and reviews with a single GraphQL query instead of several REST calls")
+	dismissStale := flag.Bool("dismiss-stale", false, "Dismiss the tool's earlier change requests when the new verdict is approve")
+	severityIconsFlag := flag.String("severity-icons", defaultSeverityIcons, "Comma-separated <severity>=<icon> mapping of the icon put in front of comments (empty disables the icons)")
+	severityEventsFlag := flag.String("severity-events", defaultSeverityEvents, "Comma-separated <severity>=<request_changes|comment> mapping deciding which comment severities block the PR")
+	defaultAction := flag.String("default-action", "request_changes", "Recommendation used when the model gives none and its tone is inconclusive: approve, request_changes or comment")
+	noTestFastPath := flag.Bool("no-test-fast-path", false, "Give PRs that only change tests the full review instead of a lighter test quality review")
+	testModel := flag.String("test-fast-path-model", "", "Cheaper model reviewing the PRs that only change tests (default "+defaultTestFastPathModel+", "+defaultAnthropicTestFastPathModel+" with -provider=anthropic)")
+	escalateTo := flag.String("escalate-to", "", "Comma-separated users and org/team slugs to request a review from when changes are requested over serious findings")
+	escalateSeverity := flag.String("escalate-severity", "blocker", "Lowest comment severity that triggers -escalate-to")
+	approvalPolicyPath := flag.String("approval-policy", "", "Path to a JSON file of conditions (changed file globs) under which the tool never approves")
+	requiredChecksFlag := flag.String("required-checks", "", "Comma-separated names of the checks whose failure prevents an approval (default: the required checks of the base branch's protection, or every check when it has none)")
+	commitContext := flag.Int("commit-context", 10, "Send the messages of the PR's most recent commits, up to this many, to the model with the changes (0 disables)")
+	maxComments := flag.Int("max-comments", defaultMaxComments, "Post at most this many inline comments, the most serious first, and note how many were omitted (0 posts them all)")
+	waitForChecks := flag.Duration("wait-for-checks", 0, "Wait up to this long (e.g. 10m) for the running checks to complete before deciding the verdict; a PR whose checks are still running is never approved")
+	autoResolve := flag.Bool("auto-resolve", false, "Resolve the tool's earlier review threads whose lines have since changed")
+	reviewTimeout := flag.Duration("review-timeout", 0, "Cancel a PR's review and post a timeout comment when it takes longer than this (e.g. 5m, 0 disables)")
+	runTimeout := flag.Duration("timeout", defaultRunTimeout, "Cancel the GitHub and model calls and exit with status 1 when the whole run takes longer than this, e.g. 10m (0, the default, disables it; -serve runs without it)")
+	promptTemplatePath := flag.String("prompt-template", "", "Path to a Go text/template file replacing the built-in review prompt")
+	systemPromptPath := flag.String("system-prompt", "", "Path to a Go text/template file replacing the built-in system prompt holding the review instructions")
+	maxRetries := flag.Int("max-retries", rateLimitRetry.Retries, "Number of times a GitHub call failing on a rate limit is retried")
+	maxWait := flag.Duration("max-wait", rateLimitRetry.MaxWait, "Longest wait for a GitHub rate limit to reset before retrying")
+	serveMode := flag.Bool("serve", false, "Run an HTTP server reviewing the PRs of GitHub pull_request webhook events (signed with GITHUB_WEBHOOK_SECRET)")
+	listen := flag.String("listen", ":8080", "Address the -serve webhook server listens on")
+	debounce := flag.Duration("debounce", 0, "With -serve, wait this long after a PR's last event before reviewing it, so rapid pushes get one review (e.g. 2m, 0 reviews every event)")
+	maxConcurrent := flag.Int("max-concurrent-reviews", 1, "Reviews the -serve webhook server runs at once, the next events wait in the queue")
+	githubURL := flag.String("github-url", "", "Base URL of a GitHub Enterprise Server, e.g. https://github.example.com (defaults to GITHUB_API_URL, then github.com)")
+	forgeName := flag.String("forge", "github", "Code host of the PR: github, or gitlab to review the merge request -pr of the project -owner/-repo (GITLAB_TOKEN)")
+	gitlabURL := flag.String("gitlab-url", "", "With -forge=gitlab, base URL of the GitLab instance (defaults to GITLAB_URL, then "+defaultGitLabURL+")")
+	configPath := flag.String("config", defaultConfigPath, "Path to the YAML config file; command-line flags override it")
+	statsDB := flag.String("stats-db", "", "Append the outcome of every reviewed PR to this CSV file")
+	statsReport := flag.Bool("stats-report", false, "Print the reviews per week, approve/block ratio and total cost recorded in -stats-db and exit")
+	printSchema := flag.Bool("print-schema", false, "Print the JSON schema of the saved review format and exit")
+	logLevel := flag.String("log-level", "info", "Least severe log messages shown: debug (includes the generated review), info, warn or error")
+	logFormat := flag.String("log-format", "text", "Format of the log messages on stderr: text, or json for machine parsing")
 	flag.Parse()
 
+	if *printSchema {
+		schema, err := jsonSchema()
+		if err != nil {
+			fmt.Printf("Error generating the schema: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(schema))
+		return
+	}
+
+	if *statsReport {
+		if *statsDB == "" {
+			fmt.Println("Error: -stats-report requires -stats-db")
+			os.Exit(1)
+		}
+		err := printStatsReport(os.Stdout, *statsDB)
+		if err != nil {
+			fmt.Printf("Error reading the stats: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The config file fills in the flags that weren't given on the command line
+	config, err := loadConfig(*configPath, *configPath != defaultConfigPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	err = applyConfig(config)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = setupLogging(*logLevel, *logFormat)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// CI passes the secrets in the environment, without a .env file
+	if errors.Is(envErr, fs.ErrNotExist) {
+		logf(slog.LevelDebug, "No .env file, reading the variables from the environment.\n")
+	} else if envErr != nil {
+		logf(slog.LevelWarn, "Warning: error loading the .env file, reading the variables from the environment: %v\n", envErr)
+	}
+
+	// -url stands for -owner, -repo and -pr
+	if *prURL != "" {
+		*owner, *repo, *prNumber, err = parsePullRequestURL(*prURL)
+		if err != nil {
+			fmt.Printf("Error parsing -url: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	severityIcons, err := parseSeverityIcons(*severityIconsFlag)
+	if err != nil {
+		fmt.Printf("Error parsing -severity-icons: %v\n", err)
+		os.Exit(1)
+	}
+
+	severityEvents, err := parseSeverityEvents(*severityEventsFlag)
+	if err != nil {
+		fmt.Printf("Error parsing -severity-events: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *format != "text" && *format != "rdjson" && *format != "rdjsonl" {
+		fmt.Println("Error: -format must be text, rdjson or rdjsonl")
+		os.Exit(1)
+	}
+
+	bodyHeader, err := readTextFlag(*bodyHeaderFlag)
+	if err != nil {
+		fmt.Printf("Error reading -body-header: %v\n", err)
+		os.Exit(1)
+	}
+	bodyFooter, err := readTextFlag(*bodyFooterFlag)
+	if err != nil {
+		fmt.Printf("Error reading -body-footer: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *diffMode != "three-dot" && *diffMode != "two-dot" {
+		fmt.Println("Error: -diff-mode must be two-dot or three-dot")
+		os.Exit(1)
+	}
+
+	commentedCodePrefixes, err := parseCommentedCodeLangs(*commentedCodeLangs)
+	if err != nil {
+		fmt.Printf("Error parsing -commented-code-langs: %v\n", err)
+		os.Exit(1)
+	}
+
+	var promptTemplate, systemPrompt *template.Template
+	if *promptTemplatePath != "" {
+		promptTemplate, err = loadPromptTemplate(*promptTemplatePath)
+		if err != nil {
+			fmt.Printf("Error loading -prompt-template: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *systemPromptPath != "" {
+		systemPrompt, err = loadPromptTemplate(*systemPromptPath)
+		if err != nil {
+			fmt.Printf("Error loading -system-prompt: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	warnMissingSpecificComments(reviewOptions{PromptTemplate: promptTemplate, SystemPrompt: systemPrompt})
+
+	approvalPolicy := config.ApprovalPolicy
+	if *approvalPolicyPath != "" {
+		approvalPolicy, err = loadApprovalPolicy(*approvalPolicyPath)
+		if err != nil {
+			fmt.Printf("Error loading -approval-policy: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	commitSpec, err := readTextFlag(*commitSpecFlag)
+	if err != nil {
+		fmt.Printf("Error reading -commit-spec: %v\n", err)
+		os.Exit(1)
+	}
+	if commitSpec == "" {
+		commitSpec = defaultCommitSpec
+	}
+
+	var seedValue *int
+	if *seed >= 0 {
+		seedValue = seed
+	}
+
+	if *provider != "openai" && *provider != "anthropic" {
+		fmt.Println("Error: -provider must be openai or anthropic")
+		os.Exit(1)
+	}
+	if maxTemperature := providerMaxTemperature(*provider); *temperature < 0 || *temperature > maxTemperature {
+		fmt.Printf("Error: -temperature must be between 0 and %g with -provider=%s\n", maxTemperature, *provider)
+		os.Exit(1)
+	}
+	if *maxResponseTokens < 0 {
+		fmt.Println("Error: -max-response-tokens can't be negative")
+		os.Exit(1)
+	}
+
+	testFastPathModel := *testModel
+	if testFastPathModel == "" {
+		_, testFastPathModel, _ = providerDefaults(*provider)
+	}
+	if *noTestFastPath {
+		testFastPathModel = ""
+	}
+
+	if !isSeverity(*escalateSeverity) {
+		fmt.Printf("Error: -escalate-severity must be one of %s\n", strings.Join(severities, ", "))
+		os.Exit(1)
+	}
+
+	if *defaultAction != "approve" && *defaultAction != "request_changes" && *defaultAction != "comment" {
+		fmt.Println("Error: -default-action must be approve, request_changes or comment")
+		os.Exit(1)
+	}
+
+	if *output != "text" && *output != "json" {
+		fmt.Println("Error: -output must be text or json")
+		os.Exit(1)
+	}
+	if *output == "json" && *format != "text" {
+		fmt.Println("Error: -output=json and -format both write to stdout, use one of them")
+		os.Exit(1)
+	}
+	// In JSON mode stdout only carries the results, the messages go to stderr with the logs
+	resultsOut := os.Stdout
+	if *output == "json" {
+		os.Stdout = os.Stderr
+	}
+
 	// Check required arguments
-	if *owner == "" || *repo == "" || *prNumber == 0 {
-		fmt.Println("Usage: gh-pr-reviewer -owner=<owner> -repo=<repo> -pr=<pr-number> [--dry] [--forcedry]")
+	if !*serveMode && (*owner == "" || *repo == "" || (*prNumber == 0 && !*sweep)) || ((*focusComment != 0 || *ask != "") && *prNumber == 0) {
+		fmt.Println("Usage: gh-pr-reviewer -owner=<owner> -repo=<repo> -pr=<pr-number>|-sweep [--dry] [--forcedry]\n       gh-pr-reviewer -url=<pr-url> [--dry] [--forcedry]\n       gh-pr-reviewer -serve [-listen=:8080]")
 		os.Exit(1)
 	}
 
-	// Initialize the GitHub client
+	opts := runOptions{
+		DryRun:               *dryRun,
+		ForceDry:             *forcedry,
+		PreviewHTML:          *previewHTML,
+		Format:               *format,
+		ExportPatch:          *exportPatch,
+		Selective:            *selective,
+		Incremental:          *incremental,
+		SkipClean:            *skipClean,
+		DiffMode:             *diffMode,
+		Completion:           completionOptions{Provider: *provider, Models: modelChain(*provider, *model, *models), Seed: seedValue, Temperature: float32(*temperature), MaxResponseTokens: *maxResponseTokens},
+		ReviewWIP:            *reviewWIP,
+		Function:             *function,
+		SummaryOnly:          *summaryOnly,
+		MaxTokens:            *maxTokens,
+		NoAI:                 *noAI,
+		ReviewsDir:           *reviewsDir,
+		CommentedCodeLines:   *commentedCodeLines,
+		CommentedCodeLangs:   commentedCodePrefixes,
+		AssetLinks:           *assetLinks,
+		ChecklistBody:        *checklistBody,
+		SkipReviewedHeads:    *resumeSweep,
+		DisableMarker:        *disableMarker,
+		WIPPrefixes:          splitList(*wipPrefixes),
+		ChecklistPath:        *checklistPath,
+		DocLinksPath:         *docLinksPath,
+		IgnoreCommentsPath:   *ignoreComments,
+		Prioritize:           *prioritize,
+		LimitFiles:           *limitFiles,
+		CoverageFile:         *coverageFile,
+		FormattedLangs:       *formattedLangs,
+		NoInline:             *noInline,
+		GroupThemes:          *groupThemesFlag,
+		GroupThemesMin:       *groupThemesMin,
+		GistOverflow:         *gistOverflow,
+		BodyHeader:           bodyHeader,
+		BodyFooter:           bodyFooter,
+		ShowProvenance:       *showProvenance,
+		PerCommitSummary:     *perCommitSummary,
+		TLDR:                 *tldr,
+		ReviewCommits:        *reviewCommits,
+		CommitSpec:           commitSpec,
+		BlastRadius:          *blastRadius,
+		BlastRadiusThreshold: *blastRadiusThreshold,
+		UseGraphQL:           *useGraphQL,
+		DismissStale:         *dismissStale,
+		SeverityEvents:       severityEvents,
+		SeverityIcons:        severityIcons,
+		DefaultAction:        *defaultAction,
+		TestFastPathModel:    testFastPathModel,
+		EscalateTo:           splitList(*escalateTo),
+		EscalateSeverity:     *escalateSeverity,
+		ApprovalPolicy:       approvalPolicy,
+		IgnoreGlobs:          append(config.Ignore, excludeGlobs...),
+		RepoOverrides:        config.Repos,
+		PromptTemplate:       promptTemplate,
+		SystemPrompt:         systemPrompt,
+		AutoResolve:          *autoResolve,
+		ReviewTimeout:        *reviewTimeout,
+		RequiredChecks:       splitList(*requiredChecksFlag),
+		WaitForChecks:        *waitForChecks,
+		CommitContext:        *commitContext,
+		MaxComments:          *maxComments,
+	}
+
+	// -no-ai never calls a model, the model-backed extras are left out
+	if opts.NoAI {
+		if *ask != "" || *focusComment != 0 {
+			fmt.Println("Error: -ask and -focus-comment need a model, they can't be used with -no-ai")
+			os.Exit(1)
+		}
+		opts.PerCommitSummary, opts.ReviewCommits, opts.TLDR = false, false, false
+	}
+
+	rateLimitRetry.Retries, rateLimitRetry.MaxWait = *maxRetries, *maxWait
+
+	// Check the API keys before doing any work, rather than failing deep inside the first call
+	if missing := missingEnv(*provider, *forgeName, opts.NoAI); len(missing) > 0 {
+		for _, name := range missing {
+			fmt.Printf("Error: set %s in the environment or the .env file\n", name)
+		}
+		if errors.Is(envErr, fs.ErrNotExist) {
+			fmt.Println("No .env file was found in the working directory.")
+		} else if envErr != nil {
+			fmt.Printf("The .env file wasn't loaded: %v\n", envErr)
+		}
+		os.Exit(2)
+	}
+
+	// Merge requests on GitLab get the reviews the forge interface allows, without the GitHub-only features
+	var host forge
+	switch *forgeName {
+	case "github":
+	case "gitlab":
+		if *serveMode || *sweep || *ask != "" || *focusComment != 0 || *prURL != "" {
+			fmt.Println("Error: -forge=gitlab only reviews the single merge request given by -owner, -repo and -pr")
+			os.Exit(1)
+		}
+		if *gitlabURL == "" {
+			*gitlabURL = os.Getenv("GITLAB_URL")
+		}
+		if *gitlabURL == "" {
+			*gitlabURL = defaultGitLabURL
+		}
+		host, err = newGitLabForge(*gitlabURL, os.Getenv("GITLAB_TOKEN"))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Println("Error: -forge must be github or gitlab")
+		os.Exit(1)
+	}
+
+	// The run's timeout covers every GitHub and model call, the webhook server runs until it's stopped
 	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv("GITHUB_TOKEN")},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	if *runTimeout > 0 && !*serveMode {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *runTimeout)
+		defer cancel()
+	}
 
-	// Fetch PR details
-	pr, _, err := client.PullRequests.Get(ctx, *owner, *repo, *prNumber)
+	// Initialize the GitHub client, as a GitHub App installation when its credentials are set
+	if *githubURL == "" {
+		*githubURL = os.Getenv("GITHUB_API_URL")
+	}
+	app, err := githubAppFromEnv()
 	if err != nil {
-		fmt.Printf("Error fetching PR details: %v\n", err)
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	var client *github.Client
+	if app != nil {
+		client, opts.BotLogin, err = newGitHubAppClient(ctx, app, *githubURL)
+		exitOnRunTimeout(ctx, *runTimeout, "authenticating as the GitHub App", err)
+		if err != nil {
+			fmt.Printf("Error authenticating as GitHub App %d: %v\n", app.ID, err)
+			os.Exit(1)
+		}
+		logf(slog.LevelInfo, "Authenticated as the GitHub App %s.\n", opts.BotLogin)
+	} else {
+		ts := oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: os.Getenv("GITHUB_TOKEN")},
+		)
+		tc := oauth2.NewClient(ctx, ts)
+		client, err = newGitHubClient(tc, *githubURL)
+		if err != nil {
+			fmt.Printf("Error creating the GitHub client for %s: %v\n", *githubURL, err)
+			os.Exit(1)
+		}
+	}
+
+	// Review the PRs GitHub sends webhook events about, until the server stops
+	if *serveMode {
+		err = serve(ctx, client, opts, *listen, os.Getenv("GITHUB_WEBHOOK_SECRET"), *statsDB, *maxConcurrent, *debounce)
+		fmt.Printf("Error serving webhooks: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Answer a question about the PR instead of reviewing it
+	if *ask != "" {
+		answer, err := askPullRequest(ctx, client, opts, *owner, *repo, *prNumber, *ask)
+		exitOnRunTimeout(ctx, *runTimeout, "answering the question", err)
+		if err != nil {
+			fmt.Printf("Error answering the question: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(answer)
+		return
+	}
+
+	// Deep-dive on a single review thread instead of a full review
+	if *focusComment != 0 {
+		err = reviewFocusComment(ctx, client, opts, *owner, *repo, *prNumber, *focusComment)
+		exitOnRunTimeout(ctx, *runTimeout, "analyzing the review comment", err)
+		if err != nil {
+			fmt.Printf("Error analyzing review comment: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	prNumbers := []int{*prNumber}
+	var progress *sweepProgress
+	interrupted := false
+	if *sweep {
+		prNumbers, err = listOpenPullRequests(ctx, client, *owner, *repo)
+		exitOnRunTimeout(ctx, *runTimeout, "listing the open PRs", err)
+		if err != nil {
+			fmt.Printf("Error listing open PRs: %v\n", err)
+			os.Exit(1)
+		}
+		logf(slog.LevelInfo, "Sweeping %d open PRs in %s/%s\n", len(prNumbers), *owner, *repo)
+
+		progress, err = loadSweepProgress(opts.ReviewsDir, *owner, *repo)
+		if err != nil {
+			fmt.Printf("Error loading the sweep progress: %v\n", err)
+			os.Exit(1)
+		}
+		if *resumeSweep {
+			var remaining []int
+			for _, number := range prNumbers {
+				if _, done := progress.Completed[number]; !done {
+					remaining = append(remaining, number)
+				}
+			}
+			logf(slog.LevelInfo, "Resuming the sweep: %d PRs were already completed, %d remain\n", len(prNumbers)-len(remaining), len(remaining))
+			prNumbers = remaining
+		} else {
+			progress.Completed = make(map[int]string)
+		}
+
+		if *maxPRs > 0 && len(prNumbers) > *maxPRs {
+			fmt.Printf("-max-prs reached: reviewing %d of %d open PRs, skipping %d.\n", *maxPRs, len(prNumbers), len(prNumbers)-*maxPRs)
+			prNumbers = prNumbers[:*maxPRs]
+			interrupted = true
+		}
+	}
+
+	var outcomes []*reviewOutcome
+	failed := false
+	totalCost := 0.0
+	for i, number := range prNumbers {
+		// whichever of -max-prs and -max-cost is reached first stops the sweep
+		if *maxCost > 0 && totalCost >= *maxCost {
+			fmt.Printf("-max-cost reached: spent $%.4f of $%.4f, skipping the remaining %d PRs.\n", totalCost, *maxCost, len(prNumbers)-i)
+			interrupted = true
+			break
+		}
+
+		var outcome *reviewOutcome
+		if host != nil {
+			outcome, err = reviewWithForge(ctx, host, opts, *owner, *repo, number)
+		} else {
+			outcome, err = reviewPullRequestWithDeadline(ctx, client, opts, *owner, *repo, number)
+		}
+		if err != nil {
+			logf(slog.LevelError, "Error reviewing PR #%d: %v\n", number, err)
+			failed = true
+		}
+		outcomes = append(outcomes, outcome)
+		totalCost += outcome.Cost
+
+		// the remaining PRs are skipped, the reports below still cover the reviewed ones
+		if err != nil && runTimedOut(ctx) {
+			logf(slog.LevelError, "The run timed out after %s while reviewing PR #%d, skipping the remaining %d PRs.\n", *runTimeout, number, len(prNumbers)-i-1)
+			interrupted = true
+			break
+		}
+
+		if progress != nil && err == nil {
+			progress.Completed[number] = outcome.HeadSHA
+			if err := progress.save(); err != nil {
+				logf(slog.LevelError, "Error saving the sweep progress: %v\n", err)
+			}
+		}
+	}
+
+	// A finished sweep starts over next time, failed PRs are retried by -resume-sweep
+	if progress != nil && !failed && !interrupted {
+		if err := progress.remove(); err != nil {
+			logf(slog.LevelError, "Error removing the sweep progress: %v\n", err)
+		}
+	}
+
+	if *batchReport != "" {
+		err = writeBatchReport(*batchReport, outcomes)
+		if err != nil {
+			fmt.Printf("Error writing batch report: %v\n", err)
+			os.Exit(1)
+		}
+		logf(slog.LevelInfo, "Batch report written to %s\n", *batchReport)
+	}
+
+	if *statsDB != "" {
+		err = appendStats(*statsDB, outcomes)
+		if err != nil {
+			fmt.Printf("Error recording stats: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *output == "json" {
+		err = writeJSONResults(resultsOut, outcomes)
+		if err != nil {
+			fmt.Printf("Error writing the JSON results: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if failed {
 		os.Exit(1)
 	}
 
+	// The verdict drives the exit code, in dry runs too, so a required CI check goes red
+	if *failOnChanges {
+		for _, outcome := range outcomes {
+			if outcome.State == "REQUEST_CHANGES" {
+				logf(slog.LevelInfo, "PR #%d: changes requested, exiting with status 1.\n", outcome.Number)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// readTextFlag returns the flag's value, or the content of the file it names when it starts with @
+func readTextFlag(value string) (string, error) {
+	if !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+	data, err := os.ReadFile(strings.TrimPrefix(value, "@"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// listOpenPullRequests returns the numbers of all open PRs of a repository
+func listOpenPullRequests(ctx context.Context, client *github.Client, owner, repo string) ([]int, error) {
+	var numbers []int
+	opts := &github.PullRequestListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		var prs []*github.PullRequest
+		var resp *github.Response
+		err := withRateLimitRetry(ctx, func() (err error) {
+			prs, resp, err = client.PullRequests.List(ctx, owner, repo, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range prs {
+			numbers = append(numbers, pr.GetNumber())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return numbers, nil
+}
+
+// reviewPullRequest runs the whole review pipeline for a single PR: fetch, generate (or load) the review and post it.
+// The returned outcome is never nil, even when an error is returned.
+func reviewPullRequest(ctx context.Context, client *github.Client, opts runOptions, owner, repo string, prNumber int) (*reviewOutcome, error) {
+	opts = opts.forRepo(owner, repo)
+	outcome := &reviewOutcome{Owner: owner, Repo: repo, Number: prNumber}
+	host := githubForge{client: client, requiredChecks: opts.RequiredChecks, checksWait: opts.WaitForChecks}
+	var err error
+
+	// With -graphql, fetch the PR, the user, the checks and the reviews in one round trip
+	var snapshot *prSnapshot
+	if opts.UseGraphQL {
+		snapshot, err = fetchPullRequestGraphQL(ctx, client, owner, repo, prNumber)
+		if err != nil {
+			logf(slog.LevelError, "Error fetching PR with GraphQL, falling back to REST: %v\n", err)
+			snapshot = nil
+		}
+	}
+
+	// Fetch PR details
+	var pr *github.PullRequest
+	if snapshot != nil {
+		pr = snapshot.PullRequest
+	} else {
+		pr, err = host.PullRequest(ctx, owner, repo, prNumber)
+		if err != nil {
+			return outcome, outcome.fail(fmt.Errorf("error fetching PR details: %w", err))
+		}
+	}
+	outcome.Title = pr.GetTitle()
+	outcome.URL = pr.GetHTMLURL()
+	outcome.HeadSHA = pr.GetHead().GetSHA()
+
+	// Drafts and WIP PRs aren't ready for a blocking review
+	if !opts.ReviewWIP && isWorkInProgress(pr, opts.WIPPrefixes) {
+		logf(slog.LevelInfo, "PR #%d is a draft or work in progress, skipping it (use -review-wip to review it anyway).\n", prNumber)
+		outcome.State = "SKIPPED"
+		return outcome, nil
+	}
+
+	// A resumed sweep doesn't pay twice for PRs whose head was already reviewed
+	if opts.SkipReviewedHeads {
+		reviewed, err := reviewedAtHead(ctx, client, owner, repo, pr)
+		if err != nil {
+			return outcome, outcome.fail(fmt.Errorf("error checking for an earlier review: %w", err))
+		}
+		if reviewed {
+			logf(slog.LevelInfo, "PR #%d was already reviewed at %s, skipping it.\n", prNumber, pr.GetHead().GetSHA())
+			outcome.State = "SKIPPED"
+			return outcome, nil
+		}
+	}
+
+	// Repositories can opt out by committing the marker file
+	if opts.DisableMarker != "" {
+		disabled, err := reviewDisabled(ctx, client, owner, repo, pr, opts.DisableMarker)
+		if err != nil {
+			return outcome, outcome.fail(fmt.Errorf("error checking for %s: %w", opts.DisableMarker, err))
+		}
+		if disabled {
+			fmt.Printf("Automated review is disabled in %s/%s by %s, skipping PR #%d.\n", owner, repo, opts.DisableMarker, prNumber)
+			outcome.State = "SKIPPED"
+			return outcome, nil
+		}
+	}
+
 	// Construct the file path for the review
-	reviewFilePath := fmt.Sprintf("reviews/%s-%s-review.json", *repo, *pr.Head.SHA)
+	reviewFilePath := filepath.Join(opts.ReviewsDir, fmt.Sprintf("%s-%s-review.json", repo, *pr.Head.SHA))
 	var savedReview *SavedReview
 
 	// Check if a review file exists for the current head SHA
@@ -69,180 +860,603 @@ func main() {
 		// File exists, load the review from the file
 		savedReview, err = loadReviewFromFile(reviewFilePath)
 		if err == nil {
-			log.Println("Using saved review from file.")
+			logf(slog.LevelInfo, "Using saved review from file.")
 			logSavedReview(savedReview)
 
-			if *dryRun {
-				log.Println("Dry run: Review not posted to GitHub.")
-				return
+			// a review saved without its state needs the checks to resolve the verdict again
+			if opts.DryRun && savedReview.State != "" {
+				if opts.Format != "text" {
+					err = writeDiagnostics(os.Stdout, opts.Format, savedReview.ReviewComments)
+					if err != nil {
+						logf(slog.LevelError, "Error writing %s output: %v\n", opts.Format, err)
+					}
+				}
+				logf(slog.LevelInfo, "Dry run: Review not posted to GitHub.")
+				outcome.State = savedReview.State
+				outcome.Comments = len(savedReview.ReviewComments)
+				outcome.Review, outcome.Action, outcome.ReviewComments = savedReview.Review, savedReview.Action, savedReview.ReviewComments
+				return outcome, nil
 			}
 		}
 	}
 
-	// Fetch the current user (the reviewer)
-	user, _, err := client.Users.Get(ctx, "")
-	if err != nil {
-		fmt.Printf("Error fetching user details: %v\n", err)
-		os.Exit(1)
+	var user *github.User
+	var checksPassed bool
+	var pendingChecks []string
+	var files []*github.CommitFile
+	var pendingReview *github.PullRequestReview
+	if opts.BotLogin != "" {
+		// a GitHub App reviews as its bot user
+		user = &github.User{Login: github.String(opts.BotLogin)}
 	}
+	if snapshot != nil {
+		if user == nil {
+			user = &github.User{Login: github.String(snapshot.Viewer)}
+		}
+		required := requiredChecks(ctx, client, owner, repo, pr.GetBase().GetRef(), opts.RequiredChecks)
+		checksPassed = requiredChecksPassed(snapshot.FailedChecks, required)
+		pendingChecks = gatingChecks(snapshot.PendingChecks, required)
+		if len(pendingChecks) > 0 && checksPassed && opts.WaitForChecks > 0 {
+			// waiting takes polling the checks
+			checksPassed, pendingChecks, err = host.ChecksPassed(ctx, owner, repo, pr)
+			if err != nil {
+				return outcome, outcome.fail(fmt.Errorf("error fetching PR checks: %w", err))
+			}
+		}
+		files = snapshot.Files
+		pendingReview = snapshot.PendingReview
+	} else {
+		// Fetch the current user (the reviewer)
+		if user == nil {
+			err = withRateLimitRetry(ctx, func() (err error) {
+				user, _, err = client.Users.Get(ctx, "")
+				return err
+			})
+			if err != nil {
+				return outcome, outcome.fail(fmt.Errorf("error fetching user details: %w", err))
+			}
+		}
 
-	// Fetch PR checks (e.g., CI tests)
-	checks, _, err := client.Checks.ListCheckRunsForRef(ctx, *owner, *repo, *pr.Head.SHA, &github.ListCheckRunsOptions{})
-	if err != nil {
-		fmt.Printf("Error fetching PR checks: %v\n", err)
-		os.Exit(1)
-	}
+		// Fetch PR checks (e.g., CI tests), a failed check doesn't allow approval
+		checksPassed, pendingChecks, err = host.ChecksPassed(ctx, owner, repo, pr)
+		if err != nil {
+			return outcome, outcome.fail(fmt.Errorf("error fetching PR checks: %w", err))
+		}
 
-	// If any check has failed, do not allow approval
-	checksPassed := true
-	for _, check := range checks.CheckRuns {
-		if check.GetConclusion() == "failure" {
-			checksPassed = false
-			break
+		// Fetch PR files
+		files, err = host.Files(ctx, owner, repo, prNumber)
+		if err != nil {
+			return outcome, outcome.fail(fmt.Errorf("error fetching PR files: %w", err))
+		}
+
+		// Check for pending reviews
+		pendingReview, err = getPendingReview(host, ctx, owner, repo, prNumber)
+		if err != nil {
+			return outcome, outcome.fail(fmt.Errorf("error checking for pending reviews: %w", err))
 		}
 	}
 
-	// Fetch PR files
-	files, _, err := client.PullRequests.ListFiles(ctx, *owner, *repo, *prNumber, &github.ListOptions{})
-	if err != nil {
-		fmt.Printf("Error fetching PR files: %v\n", err)
-		os.Exit(1)
+	// ListFiles and the GraphQL diff are three-dot (merge base) diffs. The comments are still posted,
+	// and positioned, on the PR's own diff.
+	prFiles := files
+	if opts.DiffMode == "two-dot" {
+		files, err = fetchTwoDotFiles(ctx, client, owner, repo, pr)
+		if err != nil {
+			return outcome, outcome.fail(fmt.Errorf("error fetching the two-dot diff: %w", err))
+		}
 	}
 
-	// Check for pending reviews
-	pendingReview, err := getPendingReview(client, ctx, *owner, *repo, *prNumber)
+	// Generated and vendored files only waste tokens, but the approval policy still sees them
+	changedFiles := files
+	repoGlobs, err := repoIgnoreGlobs(ctx, client, owner, repo, pr)
 	if err != nil {
-		fmt.Printf("Error checking for pending reviews: %v\n", err)
-		os.Exit(1)
+		return outcome, outcome.fail(fmt.Errorf("error reading %s: %w", repoIgnoreFile, err))
 	}
+	files = excludeFiles(files, append(append([]string{}, opts.IgnoreGlobs...), repoGlobs...))
 
 	// Handle existing pending review
 	if pendingReview != nil {
-		fmt.Println("A pending review already exists.")
-		if *dryRun {
-			fmt.Println("Dry run: Review not posted to GitHub.")
-			return
+		slog.Info("A pending review already exists.")
+		if opts.DryRun {
+			slog.Info("Dry run: Review not posted to GitHub.")
+			return outcome, nil
 		}
 
 		// Optionally, submit or dismiss the pending review here
 		// For now, we'll dismiss it to proceed with the new review
-		err = dismissPendingReview(client, ctx, *owner, *repo, *prNumber, pendingReview.GetID(), "Dismissing pending review to submit a new one.")
+		err = dismissPendingReview(client, ctx, owner, repo, prNumber, pendingReview.GetID(), "Dismissing pending review to submit a new one.")
 		if err != nil {
-			fmt.Printf("Error dismissing pending review: %v\n", err)
-			os.Exit(1)
+			return outcome, outcome.fail(fmt.Errorf("error dismissing pending review: %w", err))
 		}
 	}
 
 	var review string
 	var reviewComments []*github.DraftReviewComment
 	var action string
+	var promptVersion string
+	// reviewedFiles are the files the model saw, or whose earlier review this one carries over
+	var reviewedFiles []SavedFile
 
 	// if there is no review, or we are forcing a new one
-	if savedReview == nil || (forcedry != nil && *forcedry) {
-		// ask LLM for review
-		review, reviewComments, action, err = generateReviewWithAssistant(pr, files)
+	if savedReview == nil || opts.ForceDry {
+		genOpts, err := generationOptions(opts, files)
 		if err != nil {
-			fmt.Printf("Error generating review: %v\n", err)
-			os.Exit(1)
+			return outcome, outcome.fail(err)
+		}
+		genOpts.CrossRefs = newCrossRefLinker(ctx, client, pr, files)
+		genOpts.Issues = linkedIssuesPrompt(ctx, client, owner, repo, pr)
+		if opts.CommitContext > 0 {
+			commits, err := listPullRequestCommits(ctx, client, owner, repo, prNumber)
+			if err != nil {
+				logf(slog.LevelError, "Error fetching PR commits, reviewing without their messages: %v\n", err)
+			} else {
+				genOpts.Commits = commitsPrompt(commits, opts.CommitContext)
+			}
+		}
+
+		// Assets can't be reviewed line by line, they are only listed
+		reviewFiles, assets := splitAssets(files)
+
+		// A targeted review only sees the hunks touching one function
+		var scopes map[string]functionScope
+		if opts.Function != "" {
+			scoped, found := scopeToFunction(ctx, client, owner, repo, pr, reviewFiles, opts.Function)
+			if len(found) > 0 {
+				reviewFiles, scopes = scoped, found
+			} else {
+				logf(slog.LevelInfo, "No change to %s found, reviewing the whole PR.\n", opts.Function)
+			}
+		}
+
+		// Only send the files whose patch changed since the previous review of the PR
+		var previous *SavedReview
+		var unchangedFiles, cleanFiles, untouchedFiles []string
+		var reusedComments []*github.DraftReviewComment
+		if opts.Selective || opts.SkipClean || opts.Incremental {
+			previous = findPreviousReview(opts.ReviewsDir, owner, repo, prNumber, pr.GetHead().GetSHA())
+		}
+		if previous != nil {
+			if opts.Selective {
+				reviewFiles, unchangedFiles, reusedComments = selectChangedFiles(reviewFiles, previous)
+			} else if opts.Incremental {
+				changed, untouched, err := filesChangedSince(ctx, client, owner, repo, reviewFiles, previous.HeadSHA, pr.GetHead().GetSHA())
+				if err != nil {
+					// e.g. the previous head was force-pushed away
+					logf(slog.LevelError, "Error comparing with the previously reviewed %s, reviewing the whole PR: %v\n", previous.HeadSHA, err)
+					previous = nil
+				} else {
+					reviewFiles, untouchedFiles = changed, untouched
+					reusedComments = untouchedComments(previous, untouched)
+				}
+			} else {
+				// files that had issues are reviewed again even when unchanged
+				reviewFiles, cleanFiles = skipCleanFiles(reviewFiles, previous)
+			}
+		}
+		selectedFiles := len(reviewFiles)
+
+		if opts.Prioritize {
+			reviewFiles = prioritizeFiles(reviewFiles)
+		}
+		if opts.LimitFiles > 0 && len(reviewFiles) > opts.LimitFiles {
+			reviewFiles = reviewFiles[:opts.LimitFiles]
+		}
+
+		// ask LLM for review
+		var generated *generatedReview
+		if previous != nil && len(reviewFiles) == 0 {
+			logf(slog.LevelInfo, "No file changed since the previous review, skipping the model.")
+			generated = &generatedReview{Review: "No file changed since the previous review.", Action: previous.Action}
+		} else if len(reviewFiles) == 0 && len(assets) > 0 {
+			logf(slog.LevelInfo, "The PR only changes assets, skipping the model.")
+			generated = &generatedReview{Review: "No code changes to review: this PR only changes assets.", Action: "comment"}
+		} else if opts.NoAI {
+			generated = deterministicReview(reviewFiles, opts, genOpts.Uncovered)
+		} else {
+			generated, err = generateReviewWithAssistant(ctx, pr, reviewFiles, genOpts)
+			if err != nil {
+				return outcome, outcome.fail(fmt.Errorf("error generating review: %w", err))
+			}
+		}
+		review, reviewComments, action = generated.Review, generated.Comments, generated.Action
+		promptVersion = generated.PromptVersion
+		// Commented-out code is flagged without the model, so it's caught every time
+		if opts.CommentedCodeLines > 0 && !opts.SummaryOnly && !opts.NoAI {
+			found := commentedCodeComments(reviewFiles, opts.CommentedCodeLines, opts.CommentedCodeLangs)
+			addSeverityIcons(found, opts.SeverityIcons)
+			reviewComments = mergeCommentedCode(reviewComments, found)
+		}
+		if scopes != nil {
+			reviewComments = commentsInScope(reviewComments, scopes)
+			review = functionScopeNote(opts.Function, scopes) + "\n\n" + review
+		}
+		// the files are clean by the findings, before -max-comments caps them
+		reviewedFiles = savedFiles(reviewFiles, reviewComments)
+		if opts.SummaryOnly {
+			// the model wasn't asked for inline comments, so no file is known to be clean
+			for i := range reviewedFiles {
+				reviewedFiles[i].Clean = false
+			}
+		}
+		if previous != nil {
+			reviewedFiles = append(reviewedFiles, carriedFiles(previous, append(unchangedFiles, cleanFiles...))...)
+		}
+
+		if len(unchangedFiles) > 0 {
+			reviewComments = mergeComments(reviewComments, reusedComments)
+			// the unchanged files keep the verdict they had
+			if previous.Action == "request_changes" && len(reusedComments) > 0 {
+				action = "request_changes"
+			}
+			review += fmt.Sprintf("\n\n### Previously Reviewed\n\nThese files are unchanged since the review of %s, their %d comments are carried over:\n- `%s`", previous.HeadSHA, len(reusedComments), strings.Join(unchangedFiles, "`\n- `"))
+		}
+		if len(untouchedFiles) > 0 {
+			reviewComments = mergeComments(reviewComments, reusedComments)
+			// the untouched files keep the verdict they had
+			if previous.Action == "request_changes" && len(reusedComments) > 0 {
+				action = "request_changes"
+			}
+			review += fmt.Sprintf("\n\n### Previously Reviewed\n\nThese files weren't changed by the commits since the review of %s and weren't reviewed again, their %d comments are carried over:\n- `%s`", previous.HeadSHA, len(reusedComments), strings.Join(untouchedFiles, "`\n- `"))
+		}
+		if len(cleanFiles) > 0 {
+			review += fmt.Sprintf("\n\n### Previously Reviewed\n\nThese files had no issues in the review of %s and have no changes since:\n- `%s`", previous.HeadSHA, strings.Join(cleanFiles, "`\n- `"))
+		}
+		if len(assets) > 0 {
+			review += "\n\n" + renderAssetChanges(ctx, client, owner, repo, pr, assets, opts.AssetLinks)
+		}
+		outcome.Usage = generated.Usage
+		outcome.Cost = estimateCost(generated.Model, generated.Usage)
+
+		// Warn about changes to files much of the repository depends on
+		if opts.BlastRadius {
+			risky, err := measureBlastRadius(ctx, client, owner, repo, files, opts.BlastRadiusThreshold)
+			if err != nil {
+				logf(slog.LevelError, "Error measuring blast radius: %v\n", err)
+			} else if len(risky) > 0 {
+				review += "\n\n" + renderBlastRadius(risky)
+			}
+		}
+
+		// Per-commit summaries complement the line comments on the net diff
+		if opts.PerCommitSummary {
+			commitSummaries, err := summarizeCommits(ctx, client, opts.Completion, owner, repo, prNumber)
+			if err != nil {
+				logf(slog.LevelError, "Error generating per-commit summaries: %v\n", err)
+			} else {
+				review += "\n\n" + commitSummaries
+			}
+		}
+
+		// Commit hygiene isn't visible in the diff
+		if opts.ReviewCommits {
+			commitFeedback, err := reviewCommitMessages(ctx, client, opts.Completion, owner, repo, prNumber, opts.CommitSpec)
+			if err != nil {
+				logf(slog.LevelError, "Error reviewing commit messages: %v\n", err)
+			} else {
+				review += "\n\n" + commitFeedback
+			}
+		}
+
+		if opts.ShowProvenance {
+			review += "\n\n" + provenanceFooter(generated, opts.Completion)
+		}
+
+		if opts.TLDR {
+			tldr, err := generateTLDR(ctx, opts.Completion, review, action)
+			if err != nil {
+				logf(slog.LevelError, "Error generating TL;DR: %v\n", err)
+			} else {
+				review = prependTLDR(review, tldr)
+			}
+		}
+
+		// Dozens of inline comments overwhelm the author, the saved review keeps the capped set
+		review, reviewComments = capComments(review, reviewComments, opts.MaxComments)
+
+		if len(reviewFiles) < selectedFiles {
+			review = fmt.Sprintf("> **Partial preview:** only the first %d of %d changed files were reviewed.\n\n", len(reviewFiles), selectedFiles) + review
 		}
 
 		// Output the generated review
-		log.Println("------- Generated Review:")
-		log.Println(review)
-		log.Println("------- File comments:")
+		logf(slog.LevelDebug, "------- Generated Review:\n%s", review)
+		logf(slog.LevelDebug, "------- File comments:")
 		for _, comment := range reviewComments {
-			log.Printf("File: %s, Line: %d\nComment: %s\n", *comment.Path, *comment.Line, *comment.Body)
+			logf(slog.LevelDebug, "File: %s, Line: %d\nComment: %s\n", *comment.Path, *comment.Line, *comment.Body)
 		}
-		log.Println("-------")
+		logf(slog.LevelDebug, "-------")
 
 	} else {
 		review = savedReview.Review
 		reviewComments = savedReview.ReviewComments
 		action = savedReview.Action
+		promptVersion = savedReview.PromptVersion
+		reviewedFiles = savedReview.Files
 	}
 
-	if *dryRun || *forcedry {
-		// Save the review to a file during dry run or after force
-		err = saveReviewToFile(reviewFilePath, review, reviewComments, action)
+	// Only the review body is posted, the verdict is still the model's
+	if opts.SummaryOnly {
+		reviewComments = nil
+	}
+
+	// Emit the findings for reviewdog before they may be folded into the body
+	if opts.Format != "text" {
+		err = writeDiagnostics(os.Stdout, opts.Format, reviewComments)
 		if err != nil {
-			log.Printf("Error saving review to file: %v\n", err)
+			logf(slog.LevelError, "Error writing %s output: %v\n", opts.Format, err)
 		}
-		log.Println("Dry run: Review not posted to GitHub.")
-		// either way the force or dry run END HERE <===================================
-		return
+	}
+
+	// The verdict accounts for every finding, including those moved to the review body below. The saved
+	// review keeps them all, with the body they aren't rendered in yet, as a reused review renders them again.
+	findings := reviewComments
+	savedBody := review
+
+	if opts.ExportPatch != "" {
+		applied, err := writeSuggestionsPatch(ctx, client, pr, findings, opts.ExportPatch)
+		if err != nil {
+			logf(slog.LevelError, "Error exporting the suggestions patch: %v\n", err)
+		} else if applied > 0 {
+			logf(slog.LevelInfo, "%d suggestions exported to %s, apply them with: git apply %s\n", applied, opts.ExportPatch, opts.ExportPatch)
+		} else {
+			logf(slog.LevelInfo, "No suggestions to export.")
+		}
+	}
+
+	// Collapse recurring issues into a single bullet each
+	if opts.GroupThemes {
+		var themes string
+		reviewComments, themes = groupThemes(pr, reviewComments, opts.GroupThemesMin)
+		if themes != "" {
+			review += "\n\n" + themes
+		}
+	}
+
+	// Fold the inline comments into the review body
+	if opts.NoInline && len(reviewComments) > 0 {
+		review += "\n\n" + renderCommentList(pr, reviewComments)
+		reviewComments = nil
 	}
 
 	// Check if the reviewer is the PR author
 	isSelfReview := user.GetLogin() == pr.User.GetLogin()
 
+	// Determine the action based on the assistant's recommendation and PR checks
+	state := "COMMENT"
+	if !isSelfReview {
+		state = reviewEvent(action, checksPassed, findings, opts.SeverityEvents)
+	}
+	// The notes explain this run's verdict, they aren't saved with the review, whose verdict is resolved again when it's posted
+	var notes string
+	// CI hasn't had its say yet
+	if state == "APPROVE" && len(pendingChecks) > 0 {
+		logf(slog.LevelInfo, "Checks still running, posting a comment instead of an approval: %s\n", strings.Join(pendingChecks, ", "))
+		state = "COMMENT"
+		notes += "\n\n" + pendingChecksNote(pendingChecks)
+	}
+	// The approval policy has the last word over an approval, whatever the model and the checks say
+	if state == "APPROVE" {
+		if matched := opts.ApprovalPolicy.matchedConditions(changedFiles); len(matched) > 0 {
+			logf(slog.LevelInfo, "Approval policy conditions met, posting a comment instead of an approval: %s\n", strings.Join(matched, "; "))
+			state = "COMMENT"
+			notes += "\n\n" + requiresHumanApprovalNote(matched)
+		}
+	}
+
+	// Give the author a task list of what to fix, ticking off what changed since the last run
+	if opts.ChecklistBody && state == "REQUEST_CHANGES" {
+		blocking := findings
+		if hasSeverityTags(findings) {
+			blocking = blockingComments(findings, opts.SeverityEvents)
+		}
+		previous, err := previousRemediationItems(ctx, client, owner, repo, prNumber)
+		if err != nil {
+			logf(slog.LevelError, "Error fetching the previous remediation checklist: %v\n", err)
+		}
+		if checklist := renderRemediationChecklist(pr, blocking, previous, files); checklist != "" {
+			notes += "\n\n" + checklist
+		}
+	}
+	outcome.State = state
+	outcome.Comments = len(findings)
+	outcome.Review, outcome.Action, outcome.ReviewComments = review+notes, action, findings
+	outcome.ChecksPassed = github.Bool(checksPassed)
+
+	if opts.DryRun || opts.ForceDry {
+		// Save the review to a file during dry run or after force
+		err = saveReviewToFile(reviewFilePath, savedBody, SavedReview{
+			ReviewComments: findings,
+			Action:         action,
+			State:          state,
+			Owner:          owner,
+			Repo:           repo,
+			PRNumber:       prNumber,
+			HeadSHA:        pr.GetHead().GetSHA(),
+			Files:          reviewedFiles,
+			PromptVersion:  promptVersion,
+		})
+		if err != nil {
+			logf(slog.LevelError, "Error saving review to file: %v\n", err)
+		}
+		if opts.PreviewHTML != "" {
+			err = writePreviewHTML(opts.PreviewHTML, review+notes, reviewComments)
+			if err != nil {
+				logf(slog.LevelError, "Error writing HTML preview: %v\n", err)
+			} else {
+				logf(slog.LevelInfo, "HTML preview written to %s\n", opts.PreviewHTML)
+			}
+		}
+		logf(slog.LevelInfo, "Dry run: Review not posted to GitHub.")
+		// either way the force or dry run END HERE <===================================
+		return outcome, nil
+	}
+
+	// Resolve threads from earlier runs whose commented lines were changed
+	if opts.AutoResolve {
+		resolved, err := resolveOutdatedThreads(ctx, client, owner, repo, prNumber)
+		if err != nil {
+			logf(slog.LevelError, "Error resolving outdated review threads: %v\n", err)
+		} else {
+			logf(slog.LevelInfo, "Resolved %d outdated review threads.\n", resolved)
+		}
+	}
+
+	postOpts := postOptions{
+		GistOverflow: opts.GistOverflow,
+		BodyHeader:   opts.BodyHeader,
+		BodyFooter:   opts.BodyFooter,
+		Reviewer:     user.GetLogin(),
+	}
+
+	// Don't repeat the comments already made on the same lines
+	reviewComments, err = dropPostedComments(ctx, client, owner, repo, prNumber, reviewComments)
+	if err != nil {
+		logf(slog.LevelError, "Error deduplicating the comments, posting them all: %v\n", err)
+	}
+
 	if isSelfReview {
 		// Post the review as a comment instead
-		commentBody := review
+		commentBody := review + notes
 		if action == "approve" {
 			commentBody += "\n\n**Note:** This is a self-approved PR."
 		} else if action == "request_changes" {
 			commentBody += "\n\n**Note:** This is a self-requested change."
 		}
 
-		// Use the PullRequests.CreateReview method to post review comments directly on lines
-		reviewEvent := &github.PullRequestReviewRequest{
-			Body:     github.String(commentBody),
-			Event:    github.String("COMMENT"), // "COMMENT" will not change the state of the PR
-			Comments: reviewComments,           // Use the existing review comments
-		}
-
-		_, _, err := client.PullRequests.CreateReview(ctx, *owner, *repo, *prNumber, reviewEvent)
+		// "COMMENT" will not change the state of the PR
+		err = host.PostReview(ctx, owner, repo, prNumber, commentBody, reviewComments, prFiles, state, postOpts)
 		if err != nil {
-			log.Fatalf("\n\n GH Review self-review comments: %v\n", err)
+			return outcome, outcome.fail(fmt.Errorf("error posting self-review comments: %w", err))
 		}
 
-		fmt.Println("Self-review posted as a comment.")
+		slog.Info("Self-review posted as a comment.")
 	} else {
-		// Determine the action based on the assistant's recommendation and PR checks
-		var state string
-		if action == "approve" && checksPassed {
-			state = "APPROVE"
-		} else if action == "request_changes" || !checksPassed {
-			state = "REQUEST_CHANGES"
-		} else {
-			fmt.Println("Assistant recommended approval, but tests are failing. Requesting changes instead.")
-			state = "REQUEST_CHANGES"
+		if action == "approve" && state != "APPROVE" {
+			if state == "REQUEST_CHANGES" {
+				slog.Info("Assistant recommended approval, but tests are failing or blocking comments were found. Requesting changes instead.")
+			} else {
+				slog.Info("Assistant recommended approval, but checks are still running or the approval policy requires a human. Commenting instead.")
+			}
 		}
 
 		// Post the review if not a dry run
-		err = postReviewWithComments(client, ctx, *owner, *repo, *prNumber, review, reviewComments, state)
+		err = host.PostReview(ctx, owner, repo, prNumber, review+notes, reviewComments, prFiles, state, postOpts)
+		if err != nil {
+			return outcome, outcome.fail(fmt.Errorf("error posting review: %w", err))
+		}
+		slog.Info("Review posted successfully!")
+
+		// Loop in humans on serious findings
+		if len(opts.EscalateTo) > 0 && state == "REQUEST_CHANGES" {
+			if serious := escalationFindings(findings, opts.EscalateSeverity); len(serious) > 0 {
+				err := escalate(ctx, client, owner, repo, prNumber, opts.EscalateTo, serious)
+				if err != nil {
+					logf(slog.LevelError, "Error escalating the PR: %v\n", err)
+				}
+			}
+		}
+
+		// The earlier change request keeps blocking the PR unless it is dismissed
+		if opts.DismissStale && state == "APPROVE" {
+			dismissed, err := dismissStaleReviews(client, ctx, owner, repo, prNumber, user.GetLogin())
+			if err != nil {
+				logf(slog.LevelError, "Error dismissing stale reviews: %v\n", err)
+			} else if dismissed > 0 {
+				logf(slog.LevelInfo, "Dismissed %d stale change request(s).\n", dismissed)
+			}
+		}
+	}
+	outcome.Posted = true
+
+	// The next run only re-reviews the files changed since this one
+	if opts.Selective || opts.SkipClean || opts.Incremental {
+		err = saveReviewToFile(reviewFilePath, savedBody, SavedReview{
+			ReviewComments: findings,
+			Action:         action,
+			State:          state,
+			Owner:          owner,
+			Repo:           repo,
+			PRNumber:       prNumber,
+			HeadSHA:        pr.GetHead().GetSHA(),
+			Files:          reviewedFiles,
+			PromptVersion:  promptVersion,
+		})
+		if err != nil {
+			logf(slog.LevelError, "Error saving review to file: %v\n", err)
+		}
+	}
+
+	return outcome, nil
+}
+
+// generationOptions loads the files the review generation is configured with
+func generationOptions(opts runOptions, files []*github.CommitFile) (reviewOptions, error) {
+	genOpts := reviewOptions{Completion: opts.Completion, DefaultAction: opts.DefaultAction, TestFastPathModel: opts.TestFastPathModel, SeverityIcons: opts.SeverityIcons, MaxTokens: opts.MaxTokens, SummaryOnly: opts.SummaryOnly, PromptTemplate: opts.PromptTemplate, SystemPrompt: opts.SystemPrompt}
+	var err error
+	if opts.ChecklistPath != "" {
+		genOpts.Checklist, err = loadChecklist(opts.ChecklistPath)
+		if err != nil {
+			return genOpts, fmt.Errorf("error loading checklist: %w", err)
+		}
+	}
+	if opts.DocLinksPath != "" {
+		genOpts.DocLinks, err = loadDocLinks(opts.DocLinksPath)
+		if err != nil {
+			return genOpts, err
+		}
+	}
+	if opts.IgnoreCommentsPath != "" {
+		genOpts.IgnoreComments, err = loadIgnorePatterns(opts.IgnoreCommentsPath)
+		if err != nil {
+			return genOpts, err
+		}
+	}
+	genOpts.Formatters, err = parseFormatters(opts.FormattedLangs)
+	if err != nil {
+		return genOpts, fmt.Errorf("error parsing -formatted-langs: %w", err)
+	}
+	if opts.CoverageFile != "" {
+		report, err := loadCoverage(opts.CoverageFile)
 		if err != nil {
-			log.Fatalf("Error posting review: %v\n", err)
+			logf(slog.LevelWarn, "Skipping coverage information: %v\n", err)
+		} else {
+			genOpts.Uncovered = uncoveredAddedLines(files, report)
 		}
-		fmt.Println("Review posted successfully!")
 	}
+	return genOpts, nil
+}
+
+// fail records the error on the outcome and returns it
+func (o *reviewOutcome) fail(err error) error {
+	o.Err = err
+	return err
 }
 
 func logSavedReview(savedReview *SavedReview) {
-	log.Println("------- Loaded Review:")
-	log.Println(savedReview.Review)
-	log.Println("------- File comments:")
+	logf(slog.LevelDebug, "------- Loaded Review:\n%s", savedReview.Review)
+	logf(slog.LevelDebug, "------- File comments:")
 	for _, comment := range savedReview.ReviewComments {
-		log.Printf("File: %s, Line: %d\nComment: %s\n", *comment.Path, *comment.Line, *comment.Body)
+		logf(slog.LevelDebug, "File: %s, Line: %d\nComment: %s\n", *comment.Path, *comment.Line, *comment.Body)
 	}
-	log.Println("-------")
+	logf(slog.LevelDebug, "-------")
 }
 
-func saveReviewToFile(reviewFilePath, review string, reviewComments []*github.DraftReviewComment, action string) error {
+func saveReviewToFile(reviewFilePath, review string, savedReview SavedReview) error {
+	err := os.MkdirAll(filepath.Dir(reviewFilePath), 0755)
+	if err != nil {
+		return fmt.Errorf("error creating the reviews directory: %w", err)
+	}
+
 	// Save review content to .md file
-	mdFilePath := strings.Replace(reviewFilePath, ".json", ".md", 1)
-	err := os.WriteFile(mdFilePath, []byte(review), 0644)
+	mdFilePath := strings.TrimSuffix(reviewFilePath, ".json") + ".md"
+	err = os.WriteFile(mdFilePath, []byte(review), 0644)
 	if err != nil {
 		return fmt.Errorf("error saving review to .md file: %w", err)
 	}
 
 	// Save comments and action to .json file
 	jsonFilePath := reviewFilePath
-	savedReview := SavedReview{
-		Review:         "", // Review content is stored in .md file
-		ReviewComments: reviewComments,
-		Action:         action,
-	}
+	savedReview.Version = savedReviewVersion
+	savedReview.Review = "" // Review content is stored in .md file
 	data, err := json.MarshalIndent(savedReview, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshaling review comments and action to JSON: %w", err)
@@ -257,7 +1471,7 @@ func saveReviewToFile(reviewFilePath, review string, reviewComments []*github.Dr
 
 func loadReviewFromFile(reviewFilePath string) (*SavedReview, error) {
 	// Load review content from .md file
-	mdFilePath := strings.Replace(reviewFilePath, ".json", ".md", 1)
+	mdFilePath := strings.TrimSuffix(reviewFilePath, ".json") + ".md"
 	reviewContent, err := os.ReadFile(mdFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("error loading review content from .md file: %w", err)
@@ -275,15 +1489,43 @@ func loadReviewFromFile(reviewFilePath string) (*SavedReview, error) {
 		return nil, fmt.Errorf("error unmarshaling review comments and action from JSON: %w", err)
 	}
 
+	// Files written before the format was versioned have version 0 and are compatible with version 1
+	if savedReview.Version > savedReviewVersion {
+		return nil, fmt.Errorf("the saved review has format version %d, this version of the tool reads up to %d", savedReview.Version, savedReviewVersion)
+	}
+
 	// Replace the empty review content with the loaded content from the .md file
 	savedReview.Review = string(reviewContent)
 
 	return &savedReview, nil
 }
 
+// listReviews returns every review of the PR, walking all the pages of the listing
+func listReviews(client *github.Client, ctx context.Context, owner, repo string, prNumber int) ([]*github.PullRequestReview, error) {
+	var reviews []*github.PullRequestReview
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		var page []*github.PullRequestReview
+		var resp *github.Response
+		err := withRateLimitRetry(ctx, func() (err error) {
+			page, resp, err = client.PullRequests.ListReviews(ctx, owner, repo, prNumber, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return reviews, nil
+}
+
 // getPendingReview checks if there's a pending review for the PR
-func getPendingReview(client *github.Client, ctx context.Context, owner, repo string, prNumber int) (*github.PullRequestReview, error) {
-	reviews, _, err := client.PullRequests.ListReviews(ctx, owner, repo, prNumber, &github.ListOptions{})
+func getPendingReview(host forge, ctx context.Context, owner, repo string, prNumber int) (*github.PullRequestReview, error) {
+	reviews, err := host.Reviews(ctx, owner, repo, prNumber)
 	if err != nil {
 		return nil, err
 	}
@@ -305,29 +1547,70 @@ func dismissPendingReview(client *github.Client, ctx context.Context, owner, rep
 	return err
 }
 
+// dismissStaleReviews dismisses the tool's earlier REQUEST_CHANGES reviews so they no longer block the PR
+func dismissStaleReviews(client *github.Client, ctx context.Context, owner, repo string, prNumber int, login string) (int, error) {
+	reviews, err := listReviews(client, ctx, owner, repo, prNumber)
+	if err != nil {
+		return 0, err
+	}
+
+	dismissed := 0
+	for _, review := range reviews {
+		if review.GetState() != "CHANGES_REQUESTED" || review.GetUser().GetLogin() != login || !strings.Contains(review.GetBody(), commentMarker) {
+			continue
+		}
+		_, _, err := client.PullRequests.DismissReview(ctx, owner, repo, prNumber, review.GetID(), &github.PullRequestReviewDismissalRequest{
+			Message: github.String("The requested changes were addressed in a later review."),
+		})
+		if err != nil {
+			return dismissed, err
+		}
+		dismissed++
+	}
+	return dismissed, nil
+}
+
 func simplifyPatch(files []*github.CommitFile) string {
 	var simplifiedChanges []string
 	for _, file := range files {
 		if file.Patch != nil {
 			simplifiedChanges = append(simplifiedChanges, fmt.Sprintf("File: %s\nChanges:", *file.Filename))
 			lines := strings.Split(*file.Patch, "\n")
-			lineNumber := 0
+			hunks := parseHunks(*file.Filename, *file.Patch)
+			hunkIndex := -1
+			hunkLine := 0      // position of the line in the hunk's new side
+			lineNumber := 0    // line in the new file, for added lines
+			oldLineNumber := 0 // line in the old file, for removed lines
 			for _, line := range lines {
 				if strings.HasPrefix(line, "@@") {
-					// Extract line number from the diff header
-					// For example, @@ -1,3 +1,3 @@ means we need to start at line 1
+					// Extract line numbers from the diff header
+					// For example, @@ -4,3 +1,3 @@ means the old file starts at line 4 and the new one at line 1
 					parts := strings.Split(line, " ")
 					if len(parts) >= 3 {
+						oldLineInfo := strings.Split(parts[1][1:], ",") // -4,3 becomes 4,3
+						oldLineNumber, _ = strconv.Atoi(oldLineInfo[0])
 						newLineInfo := strings.Split(parts[2][1:], ",") // +1,3 becomes 1,3
 						lineNumber, _ = strconv.Atoi(newLineInfo[0])
 					}
+					hunkIndex++
+					hunkLine = 0
+					simplifiedChanges = append(simplifiedChanges, fmt.Sprintf("Hunk %s:", hunks[hunkIndex].ID))
 				} else if strings.HasPrefix(line, "+") {
-					simplifiedChanges = append(simplifiedChanges, fmt.Sprintf("+ Line %d: %s", lineNumber, strings.TrimPrefix(line, "+")))
+					hunkLine++
+					ref := ""
+					if hunkIndex >= 0 {
+						ref = fmt.Sprintf(" [%s:%d]", hunks[hunkIndex].ID, hunkLine)
+					}
+					simplifiedChanges = append(simplifiedChanges, fmt.Sprintf("+ Line %d%s: %s", lineNumber, ref, strings.TrimPrefix(line, "+")))
 					lineNumber++
 				} else if strings.HasPrefix(line, "-") {
-					simplifiedChanges = append(simplifiedChanges, fmt.Sprintf("- Line %d: %s", lineNumber, strings.TrimPrefix(line, "-")))
-				} else {
+					simplifiedChanges = append(simplifiedChanges, fmt.Sprintf("- Line %d: %s", oldLineNumber, strings.TrimPrefix(line, "-")))
+					oldLineNumber++
+				} else if !strings.HasPrefix(line, "\\") {
+					// context lines exist in both files
+					hunkLine++
 					lineNumber++
+					oldLineNumber++
 				}
 			}
 		}
@@ -335,14 +1618,64 @@ func simplifyPatch(files []*github.CommitFile) string {
 	return strings.Join(simplifiedChanges, "\n")
 }
 
-// generateReviewWithAssistant sends all file changes in a single prompt and generates a detailed review
-func generateReviewWithAssistant(pr *github.PullRequest, files []*github.CommitFile) (string, []*github.DraftReviewComment, string, error) {
+// reviewOptions holds the optional inputs that shape the generated review
+type reviewOptions struct {
+	// Completion holds the models to try and their settings
+	Completion completionOptions
+	// Checklist items the model must explicitly address with pass/fail/na
+	Checklist []string
+	// Formatters maps file extensions to the formatter enforcing their style
+	Formatters map[string]string
+	// DocLinks maps issue categories to documentation URLs linked from matching comments
+	DocLinks map[string]string
+	// Uncovered maps file names to added lines that no test executes
+	Uncovered map[string][]int
+	// IgnoreComments are patterns of known-bad comments that are never posted
+	IgnoreComments []*regexp.Regexp
+	// DefaultAction is the recommendation used when the model gives none and its tone is inconclusive
+	DefaultAction string
+	// CrossRefs links the file:line references of comments, nil leaves them as text
+	CrossRefs *crossRefLinker
+	// SeverityIcons maps severities to the icon put in front of their comments, empty disables the icons
+	SeverityIcons map[string]string
+	// SummaryOnly leaves the inline comments out of the prompt
+	SummaryOnly bool
+	// MaxTokens is the token budget of a prompt, larger PRs are reviewed in batches of files.
+	// 0 uses the model's context window.
+	MaxTokens int
+	// TestFastPathModel reviews the PRs that only change tests with a lighter prompt, "" disables the fast path
+	TestFastPathModel string
+	// PromptTemplate replaces the built-in review prompt, nil uses defaultPromptTemplate
+	PromptTemplate *template.Template
+	// Issues is the linked issues part of the prompt, empty when the PR closes none
+	Issues string
+	// Commits is the commit messages part of the prompt, empty without commit context
+	Commits string
+	// SystemPrompt replaces the built-in system prompt, see systemPromptTemplate
+	SystemPrompt *template.Template
+}
+
+// generatedReview is the review produced by the model
+type generatedReview struct {
+	Review   string
+	Comments []*github.DraftReviewComment
+	Action   string
+	Usage    openai.Usage
+	// Model is the model that actually produced the review
+	Model string
+	// Fingerprint identifies the backend configuration that served the model, when reported
+	Fingerprint string
+	// PromptVersion identifies the prompt the model was given, "" when no model was asked
+	PromptVersion string
+}
+
+// generateReviewWithAssistant sends the file changes in a single prompt, or in batches when they exceed
+// the token budget, and generates a detailed review
+func generateReviewWithAssistant(ctx context.Context, pr *github.PullRequest, files []*github.CommitFile, opts reviewOptions) (*generatedReview, error) {
 	if pr == nil {
-		return "", nil, "", fmt.Errorf("no pull request to process")
+		return nil, fmt.Errorf("no pull request to process")
 	}
 
-	client := openai.NewClient(os.Getenv("OPENAI_API_KEY"))
-
 	body := ""
 	title := ""
 	author := ""
@@ -359,186 +1692,769 @@ func generateReviewWithAssistant(pr *github.PullRequest, files []*github.CommitF
 		author = *pr.User.Login
 	}
 
-	// Construct the full prompt with all file changes
-	var fileChanges []string
-	fileMap := make(map[string]*github.CommitFile)
+	// Renames and mode changes have nothing to review line by line, they are only listed
+	// (and described to the model)
+	allFiles := files
+	var trivialChanges []string
+	var contentFiles []*github.CommitFile
+	for _, file := range files {
+		if note := trivialChange(file); note != "" {
+			trivialChanges = append(trivialChanges, "- "+note)
+		} else {
+			contentFiles = append(contentFiles, file)
+		}
+	}
+	files = contentFiles
+	trivialSection := ""
+	if len(trivialChanges) > 0 {
+		trivialSection = "### Renames and Mode Changes\n\n" + strings.Join(trivialChanges, "\n")
+	}
+
+	// Nothing for the model to look at, don't let it review blank sections
+	if len(files) == 0 && trivialSection != "" {
+		logf(slog.LevelInfo, "The PR only renames files or changes their mode, skipping the model.")
+		return &generatedReview{Review: "No content changes to review.\n\n" + trivialSection, Action: "comment"}, nil
+	}
+	if len(files) == 0 {
+		logf(slog.LevelInfo, "The PR has no changed files, skipping the model.")
+		return &generatedReview{Review: "No changes to review: this PR doesn't change any files.", Action: "comment"}, nil
+	}
+	hasPatch := false
 	for _, file := range files {
 		if file.Patch != nil {
-			fileChanges = append(fileChanges, fmt.Sprintf("File: %s\nPatch:\n%s", *file.Filename, *file.Patch))
-			fileMap[*file.Filename] = file
+			hasPatch = true
+			break
 		}
 	}
+	if !hasPatch {
+		logf(slog.LevelInfo, "None of the changed files has a textual diff, skipping the model.")
+		return &generatedReview{Review: "No changes to review: the changed files are binary or too large for GitHub to show a diff.", Action: "comment"}, nil
+	}
 
-	combinedChanges := strings.Join(fileChanges, "\n\n")
-	simplifiedPatch := simplifyPatch(files)
-	prompt := fmt.Sprintf(`
-	PR %s by %s: %s
-	
-	The following files were changed:
-	%s
+	// PRs changing only tests get a lighter review of the test quality on a cheaper model
+	completion := opts.Completion
+	sections := generalReviewSections
+	fastPath := opts.TestFastPathModel != "" && onlyTestFiles(files)
+	if fastPath {
+		logf(slog.LevelInfo, "The PR only changes tests, reviewing it on the test-only fast path with %s.\n", opts.TestFastPathModel)
+		completion.Models = []string{opts.TestFastPathModel}
+		sections = testReviewSections
+	}
 
-	advanced diff:
-	%s
+	model := ""
+	if len(completion.Models) > 0 {
+		model = completion.Models[0]
+	}
 
-	Summary of What the PR Does: (prettyfy this section)
+	// Large PRs are reviewed in batches of files that each fit the token budget
+	batches := [][]*github.CommitFile{allFiles}
+	if budget := tokenBudget(model, opts.MaxTokens); budget > 0 {
+		system, base, _, err := reviewPrompt(title, author, body, nil, opts, sections)
+		if err != nil {
+			return nil, err
+		}
+		batches = batchFiles(ctx, allFiles, budget-countTokens(ctx, model, system+base), model)
+	}
 
-Suggestions for Improvements or Refactoring: (prettyfy this section)
+	var parts []*generatedReview
+	for i, batch := range batches {
+		if len(batches) > 1 {
+			logf(slog.LevelInfo, "Reviewing part %d of %d (%d files)\n", i+1, len(batches), len(batch))
+		}
+		system, prompt, fileMap, err := reviewPrompt(title, author, body, batch, opts, sections)
+		if err != nil {
+			return nil, err
+		}
+		completion.System = system
+		part, err := reviewBatch(ctx, completion, prompt, fileMap, opts)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	generated := mergeBatchReviews(parts, batches)
+	generated.PromptVersion = promptVersion(opts, sections)
+	logf(slog.LevelDebug, "------- Prompt version: %s", generated.PromptVersion)
 
-Potential Bugs or Issues to Look Out For: (prettyfy this section)
+	if fastPath {
+		generated.Review = testFastPathNote + "\n\n" + generated.Review
+	}
+	if legend := severityLegend(opts.SeverityIcons); legend != "" && hasSeverityTags(generated.Comments) {
+		generated.Review += "\n\n" + legend
+	}
+	if trivialSection != "" {
+		generated.Review += "\n\n" + trivialSection
+	}
+	return generated, nil
+}
 
-Specific Comments:
+// specificCommentsPrompt asks for the inline comments, in the format parsed by extractComments
+const specificCommentsPrompt = `Specific Comments:
 
 This section should contain specific comments on lines of code where you spot bugs, issues, or things that should be changed. Only include comments on problematic lines. Use the exact format provided below for each comment, and make sure to use double quotes around filenames and comments.
 
 Format:
-- File: "filename", Line line_number: "comment"
+- File: "filename", Line hunk_id:hunk_line: "[severity] comment"
+
+Every added line of the changes is annotated with its hunk reference in square brackets, e.g. "+ Line 12 [h3fa9c1:4]: code" is the 4th line of hunk h3fa9c1. Reference lines by this hunk reference rather than by their absolute line number, which is easy to get wrong. If you can't, use the absolute number instead: - File: "filename", Line line_number: "[severity] comment".
+
+Start every comment with its severity in square brackets: [blocker] for issues that must be fixed before merging (bugs, security problems, data loss), [major] for significant problems, [minor] for smaller improvements and [nit] for cosmetic suggestions.
+
+Removing code can be as risky as adding it, e.g. a removed security check, validation or error handling. To comment on a removed line, use Removed line instead of Line, with the line number in the old version of the file, as annotated on the removed line ("- Line 42: code" is line 42 of the old file):
+- File: "filename", Removed line old_line_number: "[severity] comment"
+
+To comment on a range of lines, use Lines with the first and last line of the range (both in the same hunk):
+- File: "filename", Lines hunk_id:first_line-last_line: "[severity] comment"
+
+` + suggestionPrompt + `
+
+When a comment refers to code in another place, such as a definition in another file, reference it as path/to/file:line (e.g. internal/db/conn.go:42) so it can be linked.
 
 For multiple comments in the same file, use the format repeatedly for each line:
 
 Example:
 ### Specific Comments:
-- File: "fileA", Line 1: "comment a"
-- File: "fileA", Line 2: "comment b"
-- File: "fileB", Line 1: "comment c"
+- File: "fileA", Line h3fa9c1:1: "[blocker] comment a"
+- File: "fileA", Line h3fa9c1:2: "[minor] comment b"
+- File: "fileB", Line h07b2e4:1: "[nit] comment c"
 
 Ensure that:
 The section header remains "### Specific Comments:".
 The structure and formatting (e.g., double quotes around filenames and comments) are strictly followed.
 Do not alter or omit the double quotes.
-Each comment should start on a new line with the - symbol, followed by the word File, then the filename in double quotes, then the word Line, the line number, a colon, and finally the comment in double quotes.
+Each comment should start on a new line with the - symbol, followed by the word File, then the filename in double quotes, then the word Line, the hunk reference (or line number), a colon, and finally the comment in double quotes.
 Please adhere to the formatting rules strictly, as they are critical for automated processing.
 
-Finally, make a recommendation on whether this PR should be approved or if changes are required. Respond with approve or request_changes at the end of your review.
-
+`
+
+// suggestionPrompt asks for the optional suggestion blocks of the inline comments, in the format parsed by suggestionBlock
+const suggestionPrompt = "When you can propose the exact fix, add a suggestion block right after the comment's line: a ```suggestion fence, the code replacing the commented line (or every line of the commented range), a closing ``` fence and a line with " + suggestionSentinel + ". Only suggest complete, correct code with the original indentation; an empty block suggests deleting the lines. Removed lines can't get suggestions.\n" +
+	"- File: \"filename\", Line hunk_id:hunk_line: \"[severity] comment\"\n" +
+	"```suggestion\n" +
+	"replacement code\n" +
+	"```\n" +
+	suggestionSentinel
+
+// reviewPrompt builds the review prompt for the files, and returns it with the files that have a patch, by name
+func reviewPrompt(title, author, body string, files []*github.CommitFile, opts reviewOptions, sections string) (string, string, map[string]*github.CommitFile, error) {
+	simplifiedPatch, combinedChanges, fileMap := diffContext(files)
+	data := promptData{
+		Title:            title,
+		Author:           author,
+		Body:             body,
+		Issues:           opts.Issues,
+		Commits:          opts.Commits,
+		SimplifiedPatch:  simplifiedPatch,
+		CombinedChanges:  combinedChanges,
+		Checklist:        checklistPrompt(opts.Checklist),
+		Coverage:         coveragePrompt(opts.Uncovered),
+		Formatters:       formattersPrompt(opts.Formatters),
+		DocLinks:         docLinksPrompt(opts.DocLinks),
+		Sections:         sections,
+		SpecificComments: commentsPrompt(opts),
+	}
 
-	
+	var system, prompt strings.Builder
+	if tmpl := systemPromptTemplate(opts); tmpl != nil {
+		if err := tmpl.Execute(&system, data); err != nil {
+			return "", "", nil, fmt.Errorf("error rendering the system prompt template: %w", err)
+		}
+	}
+	if err := promptTemplate(opts).Execute(&prompt, data); err != nil {
+		return "", "", nil, fmt.Errorf("error rendering the prompt template: %w", err)
+	}
+	return system.String(), prompt.String(), fileMap, nil
+}
 
-Finally, make a recommendation on whether this PR should be approved or if changes are required. Respond with __approve__ or __request_changes__ at the end of your review.
+// reviewBatch asks the model to review a prompt and parses its response
+func reviewBatch(ctx context.Context, completion completionOptions, prompt string, fileMap map[string]*github.CommitFile, opts reviewOptions) (*generatedReview, error) {
+	if len(completion.Models) > 0 {
+		model := completion.Models[0]
+		promptTokens := countTokens(ctx, model, completion.System+prompt)
+		logf(slog.LevelDebug, "Prompt size: %d tokens for %s\n", promptTokens, model)
+		if window := contextWindow(model); window > 0 && promptTokens > window {
+			logf(slog.LevelWarn, "The prompt exceeds the %d tokens context window of %s, the request will likely fail.\n", window, model)
+		}
+	}
 
-	`, title, author, body, simplifiedPatch, combinedChanges)
+	resp, err := createCompletion(ctx, completion, prompt)
+	if err != nil {
+		return nil, err
+	}
 
-	// fmt.Println(`----------------------------------------Combined changes`, simplifiedPatch, combinedChanges)
+	responseText := resp.Choices[0].Message.Content
 
-	resp, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
-		Model: openai.GPT4oMini,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: prompt,
-			},
-		},
-		User: os.Getenv("ASSISTANT_ID"),
-	})
+	reviewComments, err := extractComments(responseText, fileMap, opts)
 	if err != nil {
-		return "", nil, "", err
+		return nil, err
 	}
+	reviewComments = filterFormattingComments(reviewComments, opts.Formatters)
+	logf(slog.LevelDebug, "------- Marked files for comments: %d", len(reviewComments))
+	responseText = removeSpecificCommentsSection(responseText)
 
-	responseText := resp.Choices[0].Message.Content
+	checklist := ""
+	if len(opts.Checklist) > 0 {
+		results := parseChecklist(responseText, opts.Checklist)
+		responseText = removeChecklistSection(responseText)
+		checklist = renderChecklist(results)
+	}
+
+	// Split the response into summary, sections and recommendation; the checklist is added after,
+	// the recommendation is at the end of the response
+	parsed := parseResponse(responseText, opts.DefaultAction)
+	parsed.Sections = appendSection(parsed.Sections, reviewSection{Content: checklist})
+	logf(slog.LevelDebug, "------- Recommendation: %s", parsed.Recommendation)
+	logf(slog.LevelDebug, "------- Model: %s", resp.Model)
+
+	return &generatedReview{
+		Review:      parsed.Body(),
+		Comments:    reviewComments,
+		Action:      parsed.Recommendation,
+		Usage:       resp.Usage,
+		Model:       resp.Model,
+		Fingerprint: resp.SystemFingerprint,
+	}, nil
+}
+
+// diffContext assembles the changes sent to the model: the line-numbered changes, the raw patches
+// and the files that have a patch, by name. Files without a patch (renames, deletions, binary files)
+// are only described by a metadata line and left out of the file map, so they never get line comments.
+func diffContext(files []*github.CommitFile) (simplifiedPatch string, combinedChanges string, fileMap map[string]*github.CommitFile) {
+	var fileChanges []string
+	var metadata []string
+	fileMap = make(map[string]*github.CommitFile)
+	for _, file := range files {
+		if file.Patch != nil {
+			fileChanges = append(fileChanges, fmt.Sprintf("File: %s\nPatch:\n%s", *file.Filename, *file.Patch))
+			fileMap[*file.Filename] = file
+		} else {
+			metadata = append(metadata, fileMetadata(file))
+		}
+	}
+	simplifiedPatch = simplifyPatch(files)
+	if len(metadata) > 0 {
+		simplifiedPatch += "\n\nFiles changed without a diff to show (metadata only, don't comment on their lines):\n" + strings.Join(metadata, "\n")
+	}
+	return simplifiedPatch, strings.Join(fileChanges, "\n\n"), fileMap
+}
+
+// reviewSection is a single "### Title" section of the model's response
+type reviewSection struct {
+	Title   string
+	Content string
+}
+
+// parsedResponse is the model's response split into its parts
+type parsedResponse struct {
+	// Summary is the content of the "Summary of What the PR Does" section
+	Summary string
+	// Sections holds every section of the response in order, including the summary
+	Sections []reviewSection
+	// Recommendation is either "approve" or "request_changes"
+	Recommendation string
+}
+
+// sectionHeaderRe matches a markdown header line of the response
+var sectionHeaderRe = regexp.MustCompile(`^#{1,4}\s+(.*)$`)
+
+// parseResponse separates the summary, the per-section content and the final recommendation.
+// The __approve__/__request_changes__ markers are removed from the section content. Without a
+// marker, the recommendation is inferred from the tone of the response, or defaultAction.
+func parseResponse(responseText string, defaultAction string) parsedResponse {
+	var parsed parsedResponse
 
 	// Parse the response to determine the action (approve or request changes)
-	var action string
-	if strings.Contains(strings.ToLower(responseText), "__approve__") {
-		action = "approve"
-	} else if strings.Contains(strings.ToLower(responseText), "__request_changes__") {
-		action = "request_changes"
+	if action := parseAction(responseText); action != "" {
+		parsed.Recommendation = action
+	} else if inferred := inferAction(responseText); inferred != "" {
+		logf(slog.LevelWarn, "No recommendation marker in the response, inferred %s from its tone.\n", inferred)
+		parsed.Recommendation = inferred
 	} else {
-		action = "request_changes" // Default to requesting changes if unsure
+		logf(slog.LevelWarn, "No recommendation marker in the response, defaulting to %s.\n", defaultAction)
+		parsed.Recommendation = defaultAction
 	}
 
-	reviewComments, err := extractComments(responseText, fileMap)
-	if err != nil {
-		return "", nil, "", err
+	current := reviewSection{}
+	inFence := false
+	for _, line := range strings.Split(stripActionMarkers(responseText), "\n") {
+		// a "# comment" line of a code block isn't a header
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		if matches := sectionHeaderRe.FindStringSubmatch(strings.TrimSpace(line)); matches != nil && !inFence {
+			parsed.Sections = appendSection(parsed.Sections, current)
+			current = reviewSection{Title: strings.Trim(matches[1], " *:")}
+			continue
+		}
+		current.Content += line + "\n"
 	}
-	log.Println(`------- Marked files for comments: `, len(reviewComments))
-	responseText = removeSpecificCommentsSection(responseText)
+	parsed.Sections = appendSection(parsed.Sections, current)
 
-	return responseText, reviewComments, action, nil
+	for _, section := range parsed.Sections {
+		if strings.Contains(strings.ToLower(section.Title), "summary") {
+			parsed.Summary = section.Content
+			break
+		}
+	}
+
+	return parsed
 }
 
-func removeSpecificCommentsSection(input string) string {
-	// Define the regex pattern to match the section between:
-	// 1. Headers with 1 to 4 `#` characters (e.g., `#### 4. Specific Comments`)
-	// 2. Numbered titles with or without bold (e.g., `4. **Specific Comments:**` or `4. Specific Comments:`)
-	// and the next `#{1,4} <some other section>` or `\d*\.?\s*\w+` (for numbered sections).
-	pattern := `(?s)(?m)(#{1,4}\s+\d*\.?\s*\**Specific Comments\**:?.*?#{1,4}\s+\d*\.?\s*\w+|\d+\.\s*\*\*Specific Comments\*\*:?|\d+\.\s*Specific Comments:.*?#{1,4}\s+\d*\.?\s*\w+)`
+// appendSection adds a section unless it has neither a title nor content
+func appendSection(sections []reviewSection, section reviewSection) []reviewSection {
+	section.Content = strings.TrimSpace(section.Content)
+	if section.Title == "" && section.Content == "" {
+		return sections
+	}
+	return append(sections, section)
+}
+
+// Body reassembles the sections into the markdown posted as the review body
+func (p parsedResponse) Body() string {
+	var parts []string
+	for _, section := range p.Sections {
+		var part string
+		if section.Title != "" {
+			part = "### " + section.Title + "\n\n"
+		}
+		parts = append(parts, strings.TrimSpace(part+section.Content))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// actionMarkerRe matches a __approve__/__request_changes__ marker with its markdown emphasis
+var actionMarkerRe = regexp.MustCompile(`(?i)[*\x60]*__(approve|request_changes)__[*\x60]*`)
+
+// markerLeftoverRe matches what's left of a line that only held an action marker
+var markerLeftoverRe = regexp.MustCompile(`^[\s*_\x60.:-]*$`)
+
+// stripActionMarkers removes the __approve__/__request_changes__ markers and drops lines left empty by the removal
+func stripActionMarkers(input string) string {
+	var lines []string
+	for _, line := range strings.Split(input, "\n") {
+		if !actionMarkerRe.MatchString(line) {
+			lines = append(lines, line)
+			continue
+		}
+		line = strings.TrimRight(actionMarkerRe.ReplaceAllString(line, ""), " ")
+		if markerLeftoverRe.MatchString(line) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// completionOptions holds the settings of the model calls
+type completionOptions struct {
+	// Provider is the model provider, openai or anthropic
+	Provider string
+	// Models is the ordered fallback chain of models to try
+	Models []string
+	// Seed makes the sampling deterministic on models that support it, nil lets the model pick
+	Seed *int
+	// Temperature is the sampling temperature, lower is more deterministic
+	Temperature float32
+	// MaxResponseTokens caps the length of the response, 0 leaves it to the provider's default
+	MaxResponseTokens int
+	// System is the system message sent before the prompt, empty sends none
+	System string
+}
+
+// modelChain returns the ordered models to try: the -model flag (or the provider's model environment
+// variable, or its default model, when neither flag is set) followed by the -models fallback chain
+func modelChain(provider, model, models string) []string {
+	chain := splitList(models)
+	if model == "" && len(chain) == 0 {
+		fallback, _, env := providerDefaults(provider)
+		model = os.Getenv(env)
+		if model == "" {
+			model = fallback
+		}
+	}
+	if model == "" {
+		return chain
+	}
+
+	result := []string{model}
+	for _, m := range chain {
+		if m != model {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// createCompletion sends a single user prompt to the first model of the chain that answers.
+// On a retryable failure (rate limit exhausted, provider unavailable) the next model is tried.
+func createCompletion(ctx context.Context, opts completionOptions, prompt string) (openai.ChatCompletionResponse, error) {
+	r := newReviewer(opts)
+
+	var resp openai.ChatCompletionResponse
+	var err error
+	models := opts.Models
+	if len(models) == 0 {
+		fallback, _, _ := providerDefaults(opts.Provider)
+		models = []string{fallback}
+	}
+	for i, model := range models {
+		resp, err = r.Generate(ctx, model, opts.System, prompt)
+		if err == nil {
+			if len(resp.Choices) == 0 {
+				return resp, fmt.Errorf("the model returned no choices")
+			}
+			if resp.Model == "" {
+				resp.Model = model
+			}
+			if resp.Usage.TotalTokens == 0 {
+				// some backends don't report usage, count the tokens for the cost estimate
+				resp.Usage.PromptTokens = countTokens(ctx, model, prompt)
+				resp.Usage.CompletionTokens = countTokens(ctx, model, resp.Choices[0].Message.Content)
+				resp.Usage.TotalTokens = resp.Usage.PromptTokens + resp.Usage.CompletionTokens
+			}
+			if resp.SystemFingerprint != "" {
+				// changes when OpenAI changes the configuration serving the model, breaking reproducibility
+				logf(slog.LevelDebug, "Model %s, system fingerprint %s\n", resp.Model, resp.SystemFingerprint)
+			}
+			return resp, nil
+		}
+
+		if !isRetryableCompletionError(err) || i == len(models)-1 {
+			// unknown model names are only rejected by the API, name the model so the error is clear
+			err = fmt.Errorf("model %s: %w", model, err)
+			break
+		}
+		logf(slog.LevelWarn, "Model %s failed (%v), falling back to %s\n", model, err, models[i+1])
+	}
+	return resp, err
+}
+
+// isRetryableCompletionError reports whether another model might succeed where this call failed
+func isRetryableCompletionError(err error) bool {
+	// the deadline applies to the whole chain
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == 429 || apiErr.HTTPStatusCode >= 500 || apiErr.HTTPStatusCode == 404
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode == 429 || reqErr.HTTPStatusCode >= 500
+	}
+	var anthropicErr *anthropicError
+	if errors.As(err, &anthropicErr) {
+		// 529 means the API is overloaded
+		return anthropicErr.StatusCode == 429 || anthropicErr.StatusCode >= 500 || anthropicErr.StatusCode == 404
+	}
+	// network errors
+	return true
+}
+
+// specificCommentsSectionRe matches the section between:
+// 1. Headers with 1 to 4 `#` characters (e.g., `#### 4. Specific Comments`)
+// 2. Numbered titles with or without bold (e.g., `4. **Specific Comments:**` or `4. Specific Comments:`)
+// and the next `#{1,4} <some other section>` or `\d*\.?\s*\w+` (for numbered sections).
+var specificCommentsSectionRe = regexp.MustCompile(`(?s)(?m)(#{1,4}\s+\d*\.?\s*\**Specific Comments\**:?.*?#{1,4}\s+\d*\.?\s*\w+|\d+\.\s*\*\*Specific Comments\*\*:?|\d+\.\s*Specific Comments:.*?#{1,4}\s+\d*\.?\s*\w+)`)
 
-	// Compile the regex pattern
-	re := regexp.MustCompile(pattern)
+// nextSectionRe matches the start of a section, headed or numbered
+var nextSectionRe = regexp.MustCompile(`#{1,4}\s+\d*\.?\s*\w+|\d+\.\s*\w+`)
 
+func removeSpecificCommentsSection(input string) string {
 	// Replace the matched section with the new section header, keeping the end section.
-	cleaned := re.ReplaceAllStringFunc(input, func(m string) string {
+	cleaned := specificCommentsSectionRe.ReplaceAllStringFunc(input, func(m string) string {
 		// Find the start of the next section to keep it intact
-		nextSection := regexp.MustCompile(`#{1,4}\s+\d*\.?\s*\w+|\d+\.\s*\w+`).FindString(m)
+		nextSection := nextSectionRe.FindString(m)
 		return nextSection
 	})
 
 	return cleaned
 }
 
-func extractComments(responseText string, fileMap map[string]*github.CommitFile) ([]*github.DraftReviewComment, error) {
+// specificCommentRe matches the File, Line, and Comment format; "Removed line" targets the old file.
+// A line is either a hunk reference like h3fa9c1:4 or an absolute line number, "Lines" take a range like 10-14.
+var specificCommentRe = regexp.MustCompile(`- File: "([^"]+)", (Removed lines?|Lines?) (?:(h[0-9a-f]{6}(?:-\d+)?):)?(\d+)(?:-(\d+))?: "([^"]+)"`)
+
+func extractComments(responseText string, fileMap map[string]*github.CommitFile, opts reviewOptions) ([]*github.DraftReviewComment, error) {
 	var reviewComments []*github.DraftReviewComment
 
 	// Identify the start of the "Specific Comments" section
 	specificCommentsIndex := strings.Index(responseText, "### Specific Comments:")
 	if specificCommentsIndex == -1 {
-		log.Println("No 'Specific Comments' section found")
+		logf(slog.LevelWarn, "No 'Specific Comments' section found")
 		return reviewComments, nil
 	}
 
 	// Extract the "Specific Comments" section
 	specificComments := responseText[specificCommentsIndex:]
 
+	// the lines of each file a comment can target; GitHub rejects the whole review when one comment
+	// targets a line outside the diff
+	diffLines := make(map[string]map[int]string, len(fileMap))
+	for filename, file := range fileMap {
+		diffLines[filename] = commentableLines(file.GetPatch())
+	}
+
 	// Split the section into individual lines
 	lines := strings.Split(specificComments, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
 
-		// Define regex to match the File, Line, and Comment format
-		re := regexp.MustCompile(`- File: "([^"]+)", Line (\d+): "([^"]+)"`)
-
-		if matches := re.FindStringSubmatch(line); matches != nil {
+		if matches := specificCommentRe.FindStringSubmatch(line); matches != nil {
 			filePart := matches[1]
-			lineNumber, err := strconv.Atoi(matches[2])
+			removedSide := strings.HasPrefix(matches[2], "Removed")
+			lineNumber, err := strconv.Atoi(matches[4])
 			if err != nil {
-				log.Printf("Invalid line number '%s' in line: %s", matches[2], line)
+				logf(slog.LevelWarn, "Invalid line number '%s' in line: %s", matches[4], line)
 				continue
 			}
-			comment := matches[3]
+			startLine := lineNumber
+			if matches[5] != "" {
+				lineNumber, err = strconv.Atoi(matches[5])
+				if err != nil {
+					logf(slog.LevelWarn, "Invalid line number '%s' in line: %s", matches[5], line)
+					continue
+				}
+			}
+			comment := opts.CrossRefs.linkify(applyDocLink(matches[6], opts.DocLinks))
+			// a suggestion block may follow the comment's line, it's kept verbatim
+			if block, consumed := suggestionBlock(lines[i+1:]); consumed > 0 {
+				i += consumed
+				if block != "" && !strings.HasPrefix(matches[2], "Removed") {
+					comment += "\n\n" + block
+				}
+			}
 
 			// Validate file part against the file map
-			if _, exists := fileMap[filePart]; exists {
-				reviewComments = append(reviewComments, &github.DraftReviewComment{
+			if file, exists := fileMap[filePart]; exists {
+				if hunkID := matches[3]; hunkID != "" && !removedSide {
+					hunks := parseHunks(filePart, file.GetPatch())
+					resolvedStart, okStart := resolveHunkLine(hunks, hunkID, startLine)
+					resolved, ok := resolveHunkLine(hunks, hunkID, lineNumber)
+					if !ok || !okStart {
+						logf(slog.LevelWarn, "Hunk line %s:%d doesn't exist in %s. Skipping comment.", hunkID, lineNumber, filePart)
+						continue
+					}
+					startLine, lineNumber = resolvedStart, resolved
+				}
+				if startLine > lineNumber {
+					logf(slog.LevelWarn, "Invalid range %d-%d in %s, the start line is after the end line. Skipping comment.", startLine, lineNumber, filePart)
+					continue
+				}
+				if !removedSide {
+					// both ends of a range must be in the diff
+					_, okStart := diffLines[filePart][startLine]
+					_, okEnd := diffLines[filePart][lineNumber]
+					if startLine == lineNumber && !okEnd {
+						logf(slog.LevelWarn, "Line %d of %s isn't part of the diff. Skipping comment.", lineNumber, filePart)
+						continue
+					}
+					if !okStart || !okEnd {
+						logf(slog.LevelWarn, "Lines %d-%d of %s aren't part of the diff. Skipping comment.", startLine, lineNumber, filePart)
+						continue
+					}
+				}
+				draft := &github.DraftReviewComment{
 					Path: &filePart,
 					Line: &lineNumber,
 					Body: &comment,
-				})
+				}
+				if removedSide {
+					removed := removedLines(file.GetPatch())
+					_, removedEnd := removed[lineNumber]
+					_, removedStart := removed[startLine]
+					if !removedEnd || !removedStart {
+						logf(slog.LevelWarn, "Line %d of the old %s wasn't removed by the PR. Skipping comment.", lineNumber, filePart)
+						continue
+					}
+					draft.Side = github.String("LEFT")
+				}
+				if startLine < lineNumber {
+					draft.StartLine = github.Int(startLine)
+					draft.StartSide = github.String("RIGHT")
+					if removedSide {
+						draft.StartSide = github.String("LEFT")
+					}
+				}
+				reviewComments = append(reviewComments, draft)
 			} else {
-				log.Printf("File %s not found in PR diff. Skipping comment.", filePart)
+				logf(slog.LevelWarn, "File %s not found in PR diff. Skipping comment.", filePart)
 			}
 		}
 	}
 
+	reviewComments = suppressIgnoredComments(reviewComments, opts.IgnoreComments)
+	addSeverityIcons(reviewComments, opts.SeverityIcons)
 	return reviewComments, nil
 }
 
+// maxReviewBodyLength is GitHub's size limit for a review body
+const maxReviewBodyLength = 65536
+
+// minReviewRoom is the least room for the review next to the header and the footer, which are dropped to make it
+const minReviewRoom = 1024
+
+// postOptions holds the optional settings used when posting a review
+type postOptions struct {
+	// GistOverflow uploads oversized reviews to a secret gist and links it from the truncated body
+	GistOverflow bool
+	// BodyHeader and BodyFooter wrap the review body; they may contain {pr}, {date} and {reviewer} placeholders
+	BodyHeader string
+	BodyFooter string
+	// Reviewer is the login of the account posting the review
+	Reviewer string
+}
+
+// wrapReviewBody surrounds the review with the header and the footer, and marks it as the tool's
+func wrapReviewBody(review string, prNumber int, opts postOptions) string {
+	placeholders := strings.NewReplacer(
+		"{pr}", strconv.Itoa(prNumber),
+		"{date}", time.Now().UTC().Format("2006-01-02"),
+		"{reviewer}", opts.Reviewer,
+	)
+	var parts []string
+	for _, part := range []string{placeholders.Replace(opts.BodyHeader), review, placeholders.Replace(opts.BodyFooter), commentMarker} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
 // postReviewWithComments posts a review on the PR with the determined action (approve or request changes), including line comments
-func postReviewWithComments(client *github.Client, ctx context.Context, owner, repo string, prNumber int, review string, comments []*github.DraftReviewComment, state string) error {
+func postReviewWithComments(client *github.Client, ctx context.Context, owner, repo string, prNumber int, review string, comments []*github.DraftReviewComment, state string, opts postOptions) error {
+	body := wrapReviewBody(review, prNumber, opts)
+	if len(body) > maxReviewBodyLength {
+		// the header and the footer are required boilerplate, only the review itself is cut, unless they
+		// leave no room for it: then the footer is dropped first, and the header next
+		room := func() int { return maxReviewBodyLength - len(wrapReviewBody(" ", prNumber, opts)) + 1 }
+		if room() < minReviewRoom {
+			logf(slog.LevelWarn, "The body header and footer leave no room for the review, dropping the footer.\n")
+			opts.BodyFooter = ""
+		}
+		if room() < minReviewRoom {
+			logf(slog.LevelWarn, "The body header leaves no room for the review, dropping it.\n")
+			opts.BodyHeader = ""
+		}
+		body = wrapReviewBody(truncateReviewBody(client, ctx, review, room(), opts.GistOverflow), prNumber, opts)
+	}
+
 	reviewEvent := &github.PullRequestReviewRequest{
-		Body:     github.String(review),
+		Body:     github.String(body),
 		Event:    github.String(state),
-		Comments: comments,
+		Comments: markComments(comments),
 	}
 
-	_, _, err := client.PullRequests.CreateReview(ctx, owner, repo, prNumber, reviewEvent)
+	err := withRateLimitRetry(ctx, func() error {
+		_, _, err := client.PullRequests.CreateReview(ctx, owner, repo, prNumber, reviewEvent)
+		return err
+	})
 	if err != nil {
-		if ghErr, ok := err.(*github.ErrorResponse); ok && ghErr.Response.StatusCode == 422 {
+		if ghErr, ok := err.(*github.ErrorResponse); ok && ghErr.Response.StatusCode == 422 && !isInvalidPositionError(err) {
 			// Handle the "one pending review" scenario
 			fmt.Println("A pending review already exists. Please submit or dismiss the existing review before posting a new one: " + err.Error())
 			return nil
 		}
 
-		log.Println("\n\n GH Review With Comments post Error: " + err.Error())
+		logf(slog.LevelError, "Error posting the review with comments: %v\n", err)
 		return err
 	}
 	return nil
 }
+
+// truncateReviewBody cuts a review to at most limit bytes, optionally linking a gist with the full text
+func truncateReviewBody(client *github.Client, ctx context.Context, review string, limit int, uploadGist bool) string {
+	note := "\n\n**[review truncated]**"
+	if uploadGist {
+		gist, _, err := client.Gists.Create(ctx, &github.Gist{
+			Description: github.String("Full PR review"),
+			Public:      github.Bool(false),
+			Files: map[github.GistFilename]github.GistFile{
+				"review.md": {Content: github.String(review)},
+			},
+		})
+		if err != nil {
+			logf(slog.LevelError, "Error uploading the full review to a gist: %v\n", err)
+		} else {
+			note = fmt.Sprintf("\n\n**[review truncated]** The full review is available [here](%s).", gist.GetHTMLURL())
+		}
+	}
+
+	logf(slog.LevelWarn, "Review body is %d characters long, truncating to %d.\n", len(review), limit)
+
+	cut := limit - len(note)
+	if cut < 0 {
+		// no room for the note either
+		note, cut = "", max(limit, 0)
+	}
+	if cut >= len(review) {
+		return review
+	}
+	// don't split a multi-byte character
+	for cut > 0 && !utf8.RuneStart(review[cut]) {
+		cut--
+	}
+	return review[:cut] + note
+}
+
+// provenanceFooter returns a compact line describing how the review was generated
+func provenanceFooter(generated *generatedReview, completion completionOptions) string {
+	footer := fmt.Sprintf("gh-pr-reviewer %s · provider: %s · model: %s · temperature: %g", version, completion.Provider, generated.Model, completion.Temperature)
+	if completion.MaxResponseTokens > 0 {
+		footer += fmt.Sprintf(" · max tokens: %d", completion.MaxResponseTokens)
+	}
+	if completion.Seed != nil {
+		footer += fmt.Sprintf(" · seed: %d", *completion.Seed)
+	}
+	if generated.Fingerprint != "" {
+		footer += " · fingerprint: " + generated.Fingerprint
+	}
+	if generated.PromptVersion != "" {
+		footer += " · prompt: " + generated.PromptVersion
+	}
+	return "<sub>" + footer + "</sub>"
+}
+
+// renderCommentList renders review comments as a numbered markdown list linking to each file and line at the head commit.
+// The lines after the first of a comment, such as a suggestion block, are indented to stay part of its item.
+func renderCommentList(pr *github.PullRequest, comments []*github.DraftReviewComment) string {
+	lines := []string{"### Findings"}
+	for i, comment := range comments {
+		marker := fmt.Sprintf("%d. ", i+1)
+		location := fmt.Sprintf("%s:%d", comment.GetPath(), comment.GetLine())
+		body := strings.Split(strings.TrimSpace(comment.GetBody()), "\n")
+		lines = append(lines, fmt.Sprintf("%s[%s](%s): %s", marker, location, commentLink(pr, comment), body[0]))
+		for _, line := range body[1:] {
+			if strings.TrimSpace(line) != "" {
+				line = strings.Repeat(" ", len(marker)) + line
+			}
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// commentLink returns the permalink to the commented line, in the base commit for comments on removed lines
+func commentLink(pr *github.PullRequest, comment *github.DraftReviewComment) string {
+	if comment.GetSide() == "LEFT" {
+		return fmt.Sprintf("%s/blob/%s/%s#L%d", pr.GetBase().GetRepo().GetHTMLURL(), pr.GetBase().GetSHA(), comment.GetPath(), comment.GetLine())
+	}
+	return blobLink(pr, comment.GetPath(), comment.GetLine())
+}
+
+// blobLink returns the permalink to a line of a file at the PR's head commit
+func blobLink(pr *github.PullRequest, path string, line int) string {
+	return fmt.Sprintf("%s/blob/%s/%s#L%d", pr.GetBase().GetRepo().GetHTMLURL(), pr.GetHead().GetSHA(), path, line)
+}
+
+// markComments returns copies of the comments with the tool's marker appended to each body
+func markComments(comments []*github.DraftReviewComment) []*github.DraftReviewComment {
+	var marked []*github.DraftReviewComment
+	for _, comment := range comments {
+		c := *comment
+		c.Body = github.String(comment.GetBody() + "\n\n" + commentMarker)
+		marked = append(marked, &c)
+	}
+	return marked
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestStripActionMarkers(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"marker line", "Looks good.\n__approve__", "Looks good."},
+		{"request changes", "Fix the leak.\n__request_changes__\n", "Fix the leak.\n"},
+		{"bold", "Summary\n**__approve__**", "Summary"},
+		{"code", "Summary\n`__request_changes__`", "Summary"},
+		{"upper case", "Summary\n__APPROVE__", "Summary"},
+		{"prefixed line", "Summary\n- __approve__.", "Summary"},
+		{"trailing marker", "Ship it __approve__", "Ship it"},
+		{"no marker", "Keep __init__ as is\n", "Keep __init__ as is\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripActionMarkers(tt.input); got != tt.want {
+				t.Errorf("stripActionMarkers(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseResponseSkipsHeadersInCodeBlocks(t *testing.T) {
+	response := "### Summary of What the PR Does\n\nAdds a setup script.\n\n### Issues\n\nQuote the path:\n```sh\n# install the hooks\ncp hooks/* .git/hooks\n```\n\n__request_changes__"
+	parsed := parseResponse(response, "approve")
+
+	if len(parsed.Sections) != 2 || parsed.Sections[1].Title != "Issues" {
+		t.Fatalf("got sections %+v, want the summary and the issues", parsed.Sections)
+	}
+	if !strings.Contains(parsed.Sections[1].Content, "# install the hooks") {
+		t.Errorf("the code block lost its comment: %q", parsed.Sections[1].Content)
+	}
+	if parsed.Summary != "Adds a setup script." || parsed.Recommendation != "request_changes" {
+		t.Errorf("got summary %q and recommendation %q", parsed.Summary, parsed.Recommendation)
+	}
+}
+
+func TestTruncateReviewBody(t *testing.T) {
+	review := strings.Repeat("a", 200) + strings.Repeat("é", 100)
+	got := truncateReviewBody(nil, context.Background(), review, 250, false)
+
+	if len(got) > 250 {
+		t.Errorf("truncated review is %d bytes long, want at most 250", len(got))
+	}
+	note := "\n\n**[review truncated]**"
+	if !strings.HasSuffix(got, note) {
+		t.Errorf("truncated review %q doesn't end with the truncation note", got)
+	}
+	kept := strings.TrimSuffix(got, note)
+	if !strings.HasPrefix(review, kept) {
+		t.Errorf("truncated review %q isn't a prefix of the review", kept)
+	}
+	if len(kept) < 250-len(note)-1 {
+		t.Errorf("kept %d bytes of the review, want %d at most one character short", len(kept), 250-len(note))
+	}
+}
+
+// failingReviewer fails the test when the model is asked for a completion
+type failingReviewer struct {
+	t *testing.T
+}
+
+func (r failingReviewer) Generate(ctx context.Context, model, system, prompt string) (openai.ChatCompletionResponse, error) {
+	r.t.Fatalf("the model was called with %q", prompt)
+	return openai.ChatCompletionResponse{}, nil
+}
+
+func TestTruncateReviewBodyWithoutRoom(t *testing.T) {
+	review := strings.Repeat("a", 100)
+	for _, limit := range []int{10, 0, -5} {
+		if got := truncateReviewBody(nil, context.Background(), review, limit, false); len(got) > max(limit, 0) {
+			t.Errorf("truncating to %d gave %d bytes", limit, len(got))
+		}
+	}
+}
+
+func TestPostReviewDropsTheFooterFirst(t *testing.T) {
+	var body string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review github.PullRequestReviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			t.Errorf("invalid review: %v", err)
+		}
+		body = review.GetBody()
+		fmt.Fprint(w, `{"id":1}`)
+	}))
+
+	opts := postOptions{BodyHeader: "Compliance preamble", BodyFooter: strings.Repeat("f", maxReviewBodyLength)}
+	err := postReviewWithComments(client, context.Background(), "octocat", "hello", 7, strings.Repeat("r", maxReviewBodyLength), nil, "COMMENT", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(body) > maxReviewBodyLength {
+		t.Errorf("posted a %d bytes body, want at most %d", len(body), maxReviewBodyLength)
+	}
+	if !strings.HasPrefix(body, "Compliance preamble") || strings.Contains(body, "fff") || !strings.Contains(body, "**[review truncated]**") {
+		t.Errorf("got a body starting with %.40q, want the header and the truncated review without the footer", body)
+	}
+}
+
+func TestGenerateReviewWithoutDiffSkipsModel(t *testing.T) {
+	defer func(original func(completionOptions) reviewer) { newReviewer = original }(newReviewer)
+	newReviewer = func(completionOptions) reviewer { return failingReviewer{t} }
+
+	tests := []struct {
+		name  string
+		files []*github.CommitFile
+	}{
+		{"no files", nil},
+		{"no patches", []*github.CommitFile{
+			{Filename: github.String("logo.png"), Status: github.String("modified")},
+			{Filename: github.String("data.csv"), Status: github.String("added")},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := &github.PullRequest{Number: github.Int(1), Title: github.String("Update assets")}
+			generated, err := generateReviewWithAssistant(context.Background(), pr, tt.files, reviewOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if generated.Action != "comment" || !strings.HasPrefix(generated.Review, "No changes to review") {
+				t.Errorf("got action %q and review %q, want a comment saying there's nothing to review", generated.Action, generated.Review)
+			}
+		})
+	}
+}
+
+func TestListReviewsWalksAllPages(t *testing.T) {
+	client := newTestClient(t, pagedHandler(t, "/repos/octocat/hello/pulls/7/reviews", []string{
+		`[{"id":1,"state":"COMMENTED"},{"id":2,"state":"APPROVED"}]`,
+		`[{"id":3,"state":"PENDING"}]`,
+	}))
+
+	reviews, err := listReviews(client, context.Background(), "octocat", "hello", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reviews) != 3 || reviews[2].GetState() != "PENDING" {
+		t.Errorf("got %d reviews, want the 3 reviews of both pages with the pending one last", len(reviews))
+	}
+}
+
+func TestProvenanceFooter(t *testing.T) {
+	generated := &generatedReview{Model: "claude-sonnet", PromptVersion: "abc123"}
+	footer := provenanceFooter(generated, completionOptions{Provider: "anthropic", Temperature: 0.2, MaxResponseTokens: 2048, Seed: github.Int(7)})
+
+	for _, want := range []string{"provider: anthropic", "model: claude-sonnet", "temperature: 0.2 ", "max tokens: 2048", "seed: 7", "prompt: abc123"} {
+		if !strings.Contains(footer, want) {
+			t.Errorf("footer %q doesn't contain %q", footer, want)
+		}
+	}
+	if footer := provenanceFooter(generated, completionOptions{Provider: "openai"}); strings.Contains(footer, "max tokens") {
+		t.Errorf("footer %q mentions max tokens without -max-response-tokens", footer)
+	}
+}
+
+func TestRenderCommentListIndentsMultilineBodies(t *testing.T) {
+	pr := &github.PullRequest{
+		Head: &github.PullRequestBranch{SHA: github.String("head1")},
+		Base: &github.PullRequestBranch{Repo: &github.Repository{HTMLURL: github.String("https://github.com/octocat/hello")}},
+	}
+	comments := []*github.DraftReviewComment{
+		{Path: github.String("main.go"), Line: github.Int(3), Body: github.String("[minor] Use a constant:\n\n```suggestion\nconst limit = 10\n```")},
+		{Path: github.String("util.go"), Line: github.Int(8), Body: github.String("[nit] Typo")},
+	}
+
+	want := "### Findings\n" +
+		"1. [main.go:3](https://github.com/octocat/hello/blob/head1/main.go#L3): [minor] Use a constant:\n" +
+		"\n" +
+		"   ```suggestion\n" +
+		"   const limit = 10\n" +
+		"   ```\n" +
+		"2. [util.go:8](https://github.com/octocat/hello/blob/head1/util.go#L8): [nit] Typo"
+	if got := renderCommentList(pr, comments); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
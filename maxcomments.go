@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// defaultMaxComments is the default number of inline comments posted on a PR
+const defaultMaxComments = 25
+
+// capComments keeps the limit most serious comments, the earliest first among equally serious ones,
+// in their original order, and notes in the review how many were omitted. A limit of 0 keeps them all.
+func capComments(review string, comments []*github.DraftReviewComment, limit int) (string, []*github.DraftReviewComment) {
+	if limit <= 0 || len(comments) <= limit {
+		return review, comments
+	}
+
+	order := make([]int, len(comments))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return severityRank(commentSeverity(comments[order[i]].GetBody())) < severityRank(commentSeverity(comments[order[j]].GetBody()))
+	})
+	kept := order[:limit]
+	sort.Ints(kept)
+
+	capped := make([]*github.DraftReviewComment, 0, limit)
+	for _, i := range kept {
+		capped = append(capped, comments[i])
+	}
+
+	omitted := len(comments) - limit
+	logf(slog.LevelInfo, "Keeping %d of %d inline comments, -max-comments reached.\n", limit, len(comments))
+	return review + fmt.Sprintf("\n\n_%d additional inline comments were omitted._", omitted), capped
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// deterministicReview reviews the files with the built-in analyzers only, without calling a model (-no-ai).
+// The PR is approved when they find nothing, otherwise the severity of the findings decides.
+func deterministicReview(files []*github.CommitFile, opts runOptions, uncovered map[string][]int) *generatedReview {
+	var comments []*github.DraftReviewComment
+	var analyzers []string
+
+	for _, analyzer := range []struct {
+		name string
+		run  func([]*github.CommitFile) []*github.DraftReviewComment
+	}{
+		{"conflict markers", conflictMarkerComments},
+		{"debug leftovers", debugLeftoverComments},
+		{"secrets", secretComments},
+	} {
+		found := analyzer.run(files)
+		comments = append(comments, found...)
+		analyzers = append(analyzers, fmt.Sprintf("%s: %d", analyzer.name, len(found)))
+	}
+	if opts.CommentedCodeLines > 0 {
+		found := commentedCodeComments(files, opts.CommentedCodeLines, opts.CommentedCodeLangs)
+		comments = append(comments, found...)
+		analyzers = append(analyzers, fmt.Sprintf("commented-out code: %d", len(found)))
+	}
+	if opts.CoverageFile != "" {
+		found := uncoveredComments(uncovered)
+		comments = append(comments, found...)
+		analyzers = append(analyzers, fmt.Sprintf("untested lines: %d", len(found)))
+	}
+	// missing tests are about the whole PR, not a line
+	missingTests := missingTestsNote(files)
+	analyzers = append(analyzers, fmt.Sprintf("missing tests: %t", missingTests != ""))
+	addSeverityIcons(comments, opts.SeverityIcons)
+	comments = mergeComments(comments, nil)
+	logf(slog.LevelInfo, "Deterministic review of %d files: %s\n", len(files), strings.Join(analyzers, ", "))
+
+	review := "No issues found by the built-in analyzers."
+	action := "approve"
+	if issues := len(comments); issues > 0 || missingTests != "" {
+		if missingTests != "" {
+			issues++
+		}
+		review = fmt.Sprintf("The built-in analyzers found %d issues.", issues)
+		action = "comment"
+	}
+	if missingTests != "" {
+		review += "\n\n" + missingTests
+	}
+	review += "\n\n_Deterministic review: no model was used._"
+	return &generatedReview{Review: review, Comments: comments, Action: action}
+}
+
+// uncoveredComments turns the added lines that no test executes into one minor comment per block of lines
+func uncoveredComments(uncovered map[string][]int) []*github.DraftReviewComment {
+	var comments []*github.DraftReviewComment
+	for filename, lines := range uncovered {
+		lines = append([]int{}, lines...)
+		sort.Ints(lines)
+		for i := 0; i < len(lines); {
+			j := i
+			for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+				j++
+			}
+			comment := &github.DraftReviewComment{
+				Path: github.String(filename),
+				Line: github.Int(lines[j]),
+				Side: github.String("RIGHT"),
+				Body: github.String("[minor] According to the coverage report, no test executes this code."),
+			}
+			if i != j {
+				comment.StartLine, comment.StartSide = github.Int(lines[i]), github.String("RIGHT")
+			}
+			comments = append(comments, comment)
+			i = j + 1
+		}
+	}
+	return comments
+}
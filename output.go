@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// jsonComment is an inline comment of the -output json result
+type jsonComment struct {
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	StartLine int    `json:"start_line,omitempty"`
+	Side      string `json:"side,omitempty"`
+	Body      string `json:"body"`
+}
+
+// jsonResult is the result of a PR's review printed by -output json
+type jsonResult struct {
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Number int    `json:"pr"`
+	// Review is the review body, without the configured header and footer
+	Review string `json:"review"`
+	// Action is the model's recommendation: approve, request_changes or comment
+	Action string `json:"action"`
+	// State is the review event posted, or that would be posted in a dry run
+	State    string        `json:"state"`
+	Comments []jsonComment `json:"comments"`
+	// ChecksPassed is nil when the checks weren't fetched, e.g. for a saved review in a dry run
+	ChecksPassed *bool   `json:"checks_passed"`
+	Posted       bool    `json:"posted"`
+	Cost         float64 `json:"cost"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// writeJSONResults prints one JSON object per reviewed PR, on its own line
+func writeJSONResults(w io.Writer, outcomes []*reviewOutcome) error {
+	encoder := json.NewEncoder(w)
+	for _, outcome := range outcomes {
+		result := jsonResult{
+			Owner:        outcome.Owner,
+			Repo:         outcome.Repo,
+			Number:       outcome.Number,
+			Review:       outcome.Review,
+			Action:       outcome.Action,
+			State:        outcome.State,
+			Comments:     jsonComments(outcome.ReviewComments),
+			ChecksPassed: outcome.ChecksPassed,
+			Posted:       outcome.Posted,
+			Cost:         outcome.Cost,
+		}
+		if outcome.Err != nil {
+			result.Error = outcome.Err.Error()
+		}
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func jsonComments(comments []*github.DraftReviewComment) []jsonComment {
+	result := []jsonComment{}
+	for _, comment := range comments {
+		result = append(result, jsonComment{
+			Path:      comment.GetPath(),
+			Line:      comment.GetLine(),
+			StartLine: comment.GetStartLine(),
+			Side:      comment.GetSide(),
+			Body:      comment.GetBody(),
+		})
+	}
+	return result
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// suggestionRe matches a GitHub suggestion block in a comment body
+var suggestionRe = regexp.MustCompile("(?s)```suggestion[^\\n]*\\n(.*?)```")
+
+// patchContext is the number of unchanged lines around each change of the exported patch
+const patchContext = 3
+
+// suggestion replaces the lines Start..End (1-based, inclusive) of a file with Lines
+type suggestion struct {
+	Start int
+	End   int
+	Lines []string
+}
+
+// commentSuggestion returns the suggestion carried by a comment, if any
+func commentSuggestion(comment *github.DraftReviewComment) (suggestion, bool) {
+	matches := suggestionRe.FindStringSubmatch(comment.GetBody())
+	if matches == nil {
+		return suggestion{}, false
+	}
+	start := comment.GetLine()
+	if comment.GetStartLine() != 0 {
+		start = comment.GetStartLine()
+	}
+	// an empty suggestion deletes the lines
+	var lines []string
+	if matches[1] != "" {
+		lines = strings.Split(strings.TrimSuffix(matches[1], "\n"), "\n")
+	}
+	return suggestion{Start: start, End: comment.GetLine(), Lines: lines}, true
+}
+
+// writeSuggestionsPatch assembles the suggestions of the comments into a unified diff of the PR's head
+// that can be applied with "git apply". Overlapping suggestions are skipped with a warning.
+func writeSuggestionsPatch(ctx context.Context, client *github.Client, pr *github.PullRequest, comments []*github.DraftReviewComment, path string) (int, error) {
+	byFile := make(map[string][]suggestion)
+	for _, comment := range comments {
+		// removed lines can't be replaced
+		if comment.GetSide() == "LEFT" {
+			continue
+		}
+		if s, ok := commentSuggestion(comment); ok {
+			byFile[comment.GetPath()] = append(byFile[comment.GetPath()], s)
+		}
+	}
+
+	var filenames []string
+	for filename := range byFile {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	repo := pr.GetBase().GetRepo()
+	var patch strings.Builder
+	applied := 0
+	for _, filename := range filenames {
+		content, _, _, err := client.Repositories.GetContents(ctx, repo.GetOwner().GetLogin(), repo.GetName(), filename, &github.RepositoryContentGetOptions{Ref: pr.GetHead().GetSHA()})
+		if err != nil {
+			logf(slog.LevelWarn, "Skipping the suggestions on %s, the file couldn't be fetched: %v\n", filename, err)
+			continue
+		}
+		text, err := content.GetContent()
+		if err != nil {
+			logf(slog.LevelWarn, "Skipping the suggestions on %s, the file couldn't be decoded: %v\n", filename, err)
+			continue
+		}
+
+		suggestions := dropOverlapping(filename, byFile[filename])
+		hunks := fileHunks(text, suggestions)
+		if hunks == "" {
+			continue
+		}
+		fmt.Fprintf(&patch, "diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n%s", filename, filename, filename, filename, hunks)
+		applied += len(suggestions)
+	}
+
+	if applied == 0 {
+		return 0, nil
+	}
+	return applied, os.WriteFile(path, []byte(patch.String()), 0644)
+}
+
+// dropOverlapping sorts the suggestions by line and skips those overlapping an earlier one
+func dropOverlapping(filename string, suggestions []suggestion) []suggestion {
+	sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].Start < suggestions[j].Start })
+	var kept []suggestion
+	for _, s := range suggestions {
+		if s.Start < 1 || s.End < s.Start {
+			logf(slog.LevelWarn, "Skipping the suggestion on %s:%d-%d, the line range is invalid.\n", filename, s.Start, s.End)
+			continue
+		}
+		if len(kept) > 0 && s.Start <= kept[len(kept)-1].End {
+			logf(slog.LevelWarn, "Skipping the suggestion on %s:%d-%d, it conflicts with the one on lines %d-%d.\n", filename, s.Start, s.End, kept[len(kept)-1].Start, kept[len(kept)-1].End)
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// fileHunks renders the hunks applying the sorted, non-overlapping suggestions to the file content.
+// Changes whose context would overlap share a hunk.
+func fileHunks(content string, suggestions []suggestion) string {
+	noFinalNewline := !strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	var valid []suggestion
+	for _, s := range suggestions {
+		if s.End > len(lines) {
+			logf(slog.LevelWarn, "Skipping the suggestion on lines %d-%d, the file only has %d lines.\n", s.Start, s.End, len(lines))
+			continue
+		}
+		valid = append(valid, s)
+	}
+
+	var b strings.Builder
+	offset := 0 // how many lines the previous hunks added to the new file
+	for i := 0; i < len(valid); {
+		// group the changes whose context windows touch
+		j := i + 1
+		for j < len(valid) && valid[j].Start-patchContext <= valid[j-1].End+patchContext+1 {
+			j++
+		}
+		group := valid[i:j]
+
+		from := max(1, group[0].Start-patchContext)
+		to := min(len(lines), group[len(group)-1].End+patchContext)
+
+		var body []string
+		oldCount, newCount := 0, 0
+		line := from
+		for _, s := range group {
+			for ; line < s.Start; line++ {
+				body = append(body, " "+lines[line-1])
+				oldCount++
+				newCount++
+			}
+			for ; line <= s.End; line++ {
+				body = append(body, "-"+lines[line-1])
+				oldCount++
+			}
+			if noFinalNewline && s.End == len(lines) {
+				body = append(body, "\\ No newline at end of file")
+			}
+			for _, added := range s.Lines {
+				body = append(body, "+"+added)
+				newCount++
+			}
+			if noFinalNewline && s.End == len(lines) && len(s.Lines) > 0 {
+				body = append(body, "\\ No newline at end of file")
+			}
+		}
+		for ; line <= to; line++ {
+			body = append(body, " "+lines[line-1])
+			oldCount++
+			newCount++
+			if noFinalNewline && line == len(lines) {
+				body = append(body, "\\ No newline at end of file")
+			}
+		}
+
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n%s\n", from, oldCount, from+offset, newCount, strings.Join(body, "\n"))
+		offset += newCount - oldCount
+		i = j
+	}
+	return b.String()
+}
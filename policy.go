@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/google/go-github/v55/github"
+)
+
+// approvalCondition is a governance rule: when any changed file matches one of its globs,
+// the PR needs a human approval
+type approvalCondition struct {
+	Name  string   `json:"name" yaml:"name"`
+	Paths []string `json:"paths" yaml:"paths"`
+}
+
+// approvalPolicy lists the conditions that never result in an automated approval
+type approvalPolicy struct {
+	Conditions []approvalCondition `json:"conditions" yaml:"conditions"`
+}
+
+// loadApprovalPolicy reads an approval policy from a JSON file
+func loadApprovalPolicy(path string) (*approvalPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading approval policy file: %w", err)
+	}
+
+	var policy approvalPolicy
+	err = json.Unmarshal(data, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing approval policy file: %w", err)
+	}
+
+	for _, condition := range policy.Conditions {
+		for _, pattern := range condition.Paths {
+			if !doublestar.ValidatePattern(pattern) {
+				return nil, fmt.Errorf("invalid glob %q in approval condition %q", pattern, condition.Name)
+			}
+		}
+	}
+	return &policy, nil
+}
+
+// matchedConditions returns a description of each condition met by the changed files
+func (p *approvalPolicy) matchedConditions(files []*github.CommitFile) []string {
+	if p == nil {
+		return nil
+	}
+
+	var matched []string
+	for _, condition := range p.Conditions {
+		var paths []string
+		for _, file := range files {
+			for _, pattern := range condition.Paths {
+				// renames remove the old path, which counts as a change to it
+				if ok, _ := doublestar.Match(pattern, file.GetFilename()); ok {
+					paths = append(paths, "`"+file.GetFilename()+"`")
+					break
+				}
+				if ok, _ := doublestar.Match(pattern, file.GetPreviousFilename()); ok && file.GetPreviousFilename() != "" {
+					paths = append(paths, "`"+file.GetPreviousFilename()+"`")
+					break
+				}
+			}
+		}
+		if len(paths) > 0 {
+			matched = append(matched, fmt.Sprintf("%s (%s)", condition.Name, strings.Join(paths, ", ")))
+		}
+	}
+	return matched
+}
+
+// requiresHumanApprovalNote explains why an approval was downgraded to a comment
+func requiresHumanApprovalNote(matched []string) string {
+	lines := []string{"> **Requires human approval:** this PR meets conditions that are never approved automatically:"}
+	for _, condition := range matched {
+		lines = append(lines, "> - "+condition)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// diffPositions maps the new-file line numbers of a patch to their position in the diff: the number of lines
+// below the first hunk header, counted across all the hunks of the file, headers included
+func diffPositions(patch string) map[int]int {
+	positions := make(map[int]int)
+	lineNumber := 0
+	for position, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			parts := strings.Split(line, " ")
+			lineNumber = 0
+			if len(parts) >= 3 {
+				lineNumber, _ = strconv.Atoi(strings.Split(strings.TrimPrefix(parts[2], "+"), ",")[0])
+			}
+		case strings.HasPrefix(line, "-"), strings.HasPrefix(line, "\\"):
+		case lineNumber > 0:
+			positions[lineNumber] = position
+			lineNumber++
+		}
+	}
+	return positions
+}
+
+// positionComments returns the comments with those on a single line of the new file targeting their position
+// in the diff, which GitHub resolves more reliably than line numbers on files with several hunks.
+// Ranges, comments on removed lines and lines that don't map keep their line number.
+func positionComments(comments []*github.DraftReviewComment, files []*github.CommitFile) []*github.DraftReviewComment {
+	positions := make(map[string]map[int]int)
+	for _, file := range files {
+		if file.Patch != nil {
+			positions[file.GetFilename()] = diffPositions(file.GetPatch())
+		}
+	}
+
+	var positioned []*github.DraftReviewComment
+	for _, comment := range comments {
+		position, ok := positions[comment.GetPath()][comment.GetLine()]
+		if !ok || comment.StartLine != nil || comment.GetSide() == "LEFT" {
+			positioned = append(positioned, comment)
+			continue
+		}
+		c := *comment
+		c.Position = github.Int(position)
+		c.Line, c.Side = nil, nil
+		positioned = append(positioned, &c)
+	}
+	return positioned
+}
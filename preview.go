@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// markdownRenderer renders GitHub-flavored markdown (tables, task lists, strikethrough, autolinks)
+var markdownRenderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// tableDelimiterRe matches the "|---|:--:|" row that separates a table header from its body
+var tableDelimiterRe = regexp.MustCompile(`^\|?(\s*:?-+:?\s*\|)+\s*:?-*:?\s*\|?$`)
+
+// validateMarkdown reports common rendering problems: unclosed code fences, tables whose rows
+// don't match the header's column count and unclosed <details> blocks
+func validateMarkdown(markdown string) []string {
+	var problems []string
+
+	lines := strings.Split(markdown, "\n")
+	fenceOpen := 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			if fenceOpen == 0 {
+				fenceOpen = i + 1
+			} else {
+				fenceOpen = 0
+			}
+			continue
+		}
+		if fenceOpen != 0 {
+			continue
+		}
+
+		// a table starts with a header row followed by a delimiter row
+		if i+1 < len(lines) && strings.Contains(trimmed, "|") && tableDelimiterRe.MatchString(strings.TrimSpace(lines[i+1])) {
+			columns := tableColumns(trimmed)
+			for j := i + 2; j < len(lines) && strings.Contains(lines[j], "|"); j++ {
+				if got := tableColumns(strings.TrimSpace(lines[j])); got != columns {
+					problems = append(problems, fmt.Sprintf("line %d: table row has %d columns, the header has %d", j+1, got, columns))
+				}
+			}
+		}
+	}
+	if fenceOpen != 0 {
+		problems = append(problems, fmt.Sprintf("line %d: code fence is never closed", fenceOpen))
+	}
+
+	if open, closed := strings.Count(markdown, "<details"), strings.Count(markdown, "</details>"); open != closed {
+		problems = append(problems, fmt.Sprintf("%d <details> blocks but %d </details>", open, closed))
+	}
+
+	return problems
+}
+
+// tableColumns counts the cells of a markdown table row, ignoring escaped pipes
+func tableColumns(row string) int {
+	row = strings.ReplaceAll(row, `\|`, "")
+	row = strings.TrimSuffix(strings.TrimPrefix(row, "|"), "|")
+	return strings.Count(row, "|") + 1
+}
+
+// renderMarkdown converts GitHub-flavored markdown to HTML
+func renderMarkdown(markdown string) (string, error) {
+	var buf bytes.Buffer
+	err := markdownRenderer.Convert([]byte(markdown), &buf)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// writePreviewHTML renders the review body and its inline comments to an HTML page, listing any
+// markdown problems found at the top
+func writePreviewHTML(path string, review string, comments []*github.DraftReviewComment) error {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Review preview</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 900px; margin: 2em auto; line-height: 1.5; }
+.problems { background: #fff8c5; border: 1px solid #d4a72c; padding: 0.5em 1em; }
+.comment { border: 1px solid #d0d7de; border-radius: 6px; margin: 1em 0; padding: 0 1em; }
+.location { font-family: monospace; color: #57606a; padding-top: 0.5em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #d0d7de; padding: 4px 8px; }
+pre { background: #f6f8fa; padding: 1em; overflow: auto; }
+</style>
+</head>
+<body>
+`)
+
+	var problems []string
+	for _, problem := range validateMarkdown(review) {
+		problems = append(problems, "Review body, "+problem)
+	}
+	for _, comment := range comments {
+		for _, problem := range validateMarkdown(comment.GetBody()) {
+			problems = append(problems, fmt.Sprintf("Comment on %s:%d, %s", comment.GetPath(), comment.GetLine(), problem))
+		}
+	}
+	if len(problems) > 0 {
+		b.WriteString("<div class=\"problems\"><strong>Markdown problems</strong><ul>\n")
+		for _, problem := range problems {
+			fmt.Fprintf(&b, "<li>%s</li>\n", html.EscapeString(problem))
+		}
+		b.WriteString("</ul></div>\n")
+	}
+
+	rendered, err := renderMarkdown(review)
+	if err != nil {
+		return fmt.Errorf("error rendering review body: %w", err)
+	}
+	b.WriteString(rendered)
+
+	if len(comments) > 0 {
+		b.WriteString("<h2>Inline comments</h2>\n")
+	}
+	for _, comment := range comments {
+		rendered, err := renderMarkdown(comment.GetBody())
+		if err != nil {
+			return fmt.Errorf("error rendering comment on %s:%d: %w", comment.GetPath(), comment.GetLine(), err)
+		}
+		fmt.Fprintf(&b, "<div class=\"comment\"><div class=\"location\">%s:%d</div>\n%s</div>\n",
+			html.EscapeString(comment.GetPath()), comment.GetLine(), rendered)
+	}
+
+	b.WriteString("</body>\n</html>\n")
+
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
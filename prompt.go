@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// promptData is what the review prompt template is rendered with. Besides the PR and its changes,
+// it holds the optional prompt parts (empty when unused) so a custom template can keep them.
+type promptData struct {
+	Title  string
+	Author string
+	Body   string
+	// Issues is the issues the PR closes
+	Issues string
+	// Commits is the messages of the PR's most recent commits
+	Commits string
+	// SimplifiedPatch is the line-numbered changes with their hunk references
+	SimplifiedPatch string
+	// CombinedChanges is the raw patches of the files
+	CombinedChanges string
+	Checklist       string
+	Coverage        string
+	Formatters      string
+	DocLinks        string
+	// Sections lists the sections the review must have
+	Sections string
+	// SpecificComments is the format of the inline comments parsed by extractComments,
+	// empty with -summary-only
+	SpecificComments string
+}
+
+// specificCommentsHeader is the section header extractComments looks for in the response
+const specificCommentsHeader = "### Specific Comments:"
+
+// defaultPromptTemplate is the review prompt used without -prompt-template: the PR's data only,
+// the instructions are in the system prompt
+var defaultPromptTemplate = template.Must(template.New("prompt").Parse(`
+	PR {{.Title}} by {{.Author}}: {{.Body}}
+
+	{{.Issues}}
+	{{.Commits}}
+	The following files were changed:
+	{{.SimplifiedPatch}}
+
+	advanced diff:
+	{{.CombinedChanges}}
+
+	{{.Coverage}}
+	`))
+
+// defaultSystemPromptTemplate is the system prompt used without -system-prompt: how to review the PR
+// of the user message and the format of the response parseResponse and extractComments rely on
+var defaultSystemPromptTemplate = template.Must(template.New("system").Parse(`You review the pull request given in the user message.
+
+{{.Checklist}}
+{{.Formatters}}
+{{.DocLinks}}
+{{.Sections}}
+
+{{.SpecificComments}}Finally, make a recommendation on whether this PR should be approved or if changes are required. Respond with __approve__ or __request_changes__ at the end of your review.
+`))
+
+// loadPromptTemplate reads a custom review prompt template. It is checked against an empty PR so that
+// references to unknown fields fail now rather than in the middle of a review.
+func loadPromptTemplate(path string) (*template.Template, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading prompt template: %w", err)
+	}
+	tmpl, err := template.New(path).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing prompt template: %w", err)
+	}
+	if err := tmpl.Execute(io.Discard, promptData{}); err != nil {
+		return nil, fmt.Errorf("error rendering prompt template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// warnMissingSpecificComments logs a warning when neither the system prompt nor the review prompt asks
+// for the inline comments, which are only found when the model answers in the expected format
+func warnMissingSpecificComments(opts reviewOptions) {
+	text := promptTemplate(opts).Root.String()
+	if system := systemPromptTemplate(opts); system != nil {
+		text += system.Root.String()
+	}
+	if !strings.Contains(text, specificCommentsHeader) && !strings.Contains(text, ".SpecificComments") {
+		logf(slog.LevelWarn, "Warning: the prompt templates neither contain %q nor {{.SpecificComments}}, the model's inline comments won't be found.\n", specificCommentsHeader)
+	}
+}
+
+// promptTemplate returns the review prompt template to use
+func promptTemplate(opts reviewOptions) *template.Template {
+	if opts.PromptTemplate != nil {
+		return opts.PromptTemplate
+	}
+	return defaultPromptTemplate
+}
+
+// systemPromptTemplate returns the system prompt template to use. A custom review prompt without a custom
+// system prompt carries the instructions itself, as it did before there was a system prompt, so it gets none.
+func systemPromptTemplate(opts reviewOptions) *template.Template {
+	if opts.SystemPrompt != nil {
+		return opts.SystemPrompt
+	}
+	if opts.PromptTemplate != nil {
+		return nil
+	}
+	return defaultSystemPromptTemplate
+}
+
+// commentsPrompt returns the inline comments part of the prompt. Summaries don't pay for comments
+// that would be thrown away.
+func commentsPrompt(opts reviewOptions) string {
+	if opts.SummaryOnly {
+		return ""
+	}
+	return specificCommentsPrompt
+}
+
+// promptVersion identifies the prompt a review is generated with: a hash of the template and of the
+// fixed parts it's rendered with, so it changes whenever the prompt's wording does
+func promptVersion(opts reviewOptions, sections string) string {
+	system := ""
+	if tmpl := systemPromptTemplate(opts); tmpl != nil {
+		system = tmpl.Root.String()
+	}
+	sum := sha256.Sum256([]byte(system + "\x00" + promptTemplate(opts).Root.String() + "\x00" + commentsPrompt(opts) + "\x00" + sections))
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultAnthropicModel is the Claude model used with -provider=anthropic unless -model, -models or ANTHROPIC_MODEL say otherwise
+const defaultAnthropicModel = "claude-3-5-sonnet-latest"
+
+// defaultAnthropicTestFastPathModel is the cheaper Claude model reviewing the PRs that only change tests
+const defaultAnthropicTestFastPathModel = "claude-3-5-haiku-latest"
+
+// anthropicMaxTokens caps the length of Claude's responses unless -max-response-tokens is set, the Messages API requires a limit
+const anthropicMaxTokens = 4096
+
+// defaultTemperature keeps the reviews close to deterministic unless -temperature says otherwise
+const defaultTemperature = 0.2
+
+// providerMaxTemperature is the highest sampling temperature the provider accepts
+func providerMaxTemperature(provider string) float64 {
+	if provider == "anthropic" {
+		return 1
+	}
+	return 2
+}
+
+// reviewer is a model provider turning a prompt into a completion. The response is shaped like an
+// OpenAI chat completion whatever the provider, so the rest of the tool doesn't depend on it.
+type reviewer interface {
+	Generate(ctx context.Context, model, system, prompt string) (openai.ChatCompletionResponse, error)
+}
+
+// newReviewer returns the reviewer of the configured provider, tests replace it with a stub
+var newReviewer = providerReviewer
+
+// providerReviewer returns the reviewer of the configured provider
+func providerReviewer(opts completionOptions) reviewer {
+	switch opts.Provider {
+	case "anthropic":
+		return &anthropicReviewer{apiKey: os.Getenv("ANTHROPIC_API_KEY"), client: http.DefaultClient, temperature: opts.Temperature, maxTokens: opts.MaxResponseTokens}
+	default:
+		return &openAIReviewer{client: openai.NewClient(os.Getenv("OPENAI_API_KEY")), seed: opts.Seed, temperature: opts.Temperature, maxTokens: opts.MaxResponseTokens}
+	}
+}
+
+// providerDefaults returns the default model and test fast path model of a provider,
+// and the environment variable overriding the default model
+func providerDefaults(provider string) (model, testModel, env string) {
+	if provider == "anthropic" {
+		return defaultAnthropicModel, defaultAnthropicTestFastPathModel, "ANTHROPIC_MODEL"
+	}
+	return defaultModel, defaultTestFastPathModel, "OPENAI_MODEL"
+}
+
+// openAIReviewer generates completions with the OpenAI Chat Completions API
+type openAIReviewer struct {
+	client      *openai.Client
+	seed        *int
+	temperature float32
+	maxTokens   int
+}
+
+func (r *openAIReviewer) Generate(ctx context.Context, model, system, prompt string) (openai.ChatCompletionResponse, error) {
+	temperature := r.temperature
+	if temperature == 0 {
+		// a zero temperature is omitted from the request, which means the API's default of 1
+		temperature = math.SmallestNonzeroFloat32
+	}
+	var messages []openai.ChatCompletionMessage
+	if system != "" {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: system,
+		})
+	}
+	messages = append(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: prompt,
+	})
+	return r.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:       model,
+		Messages:    messages,
+		User:        os.Getenv("ASSISTANT_ID"),
+		Seed:        r.seed,
+		Temperature: temperature,
+		MaxTokens:   r.maxTokens,
+	})
+}
+
+// anthropicReviewer generates completions with the Anthropic Messages API
+type anthropicReviewer struct {
+	apiKey      string
+	client      *http.Client
+	temperature float32
+	maxTokens   int
+}
+
+// anthropicError is an error response of the Anthropic API
+type anthropicError struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *anthropicError) Error() string {
+	return fmt.Sprintf("anthropic API error, status code: %d, type: %s, message: %s", e.StatusCode, e.Type, e.Message)
+}
+
+func (r *anthropicReviewer) Generate(ctx context.Context, model, system, prompt string) (openai.ChatCompletionResponse, error) {
+	var resp openai.ChatCompletionResponse
+	if r.apiKey == "" {
+		return resp, fmt.Errorf("ANTHROPIC_API_KEY is not set")
+	}
+
+	maxTokens := r.maxTokens
+	if maxTokens == 0 {
+		maxTokens = anthropicMaxTokens
+	}
+	request := map[string]any{
+		"model":       model,
+		"max_tokens":  maxTokens,
+		"temperature": r.temperature,
+		"messages":    []map[string]string{{"role": "user", "content": prompt}},
+	}
+	if system != "" {
+		// the Messages API takes the system prompt apart from the messages
+		request["system"] = system
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return resp, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return resp, err
+	}
+	req.Header.Set("x-api-key", r.apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	req.Header.Set("content-type", "application/json")
+
+	httpResp, err := r.client.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return resp, err
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &errResp) != nil || errResp.Error.Message == "" {
+			errResp.Error.Message = strings.TrimSpace(string(data))
+		}
+		return resp, &anthropicError{StatusCode: httpResp.StatusCode, Type: errResp.Error.Type, Message: errResp.Error.Message}
+	}
+
+	var message struct {
+		ID      string `json:"id"`
+		Model   string `json:"model"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string `json:"stop_reason"`
+		Usage      struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return resp, fmt.Errorf("error decoding the anthropic response: %w", err)
+	}
+
+	var text strings.Builder
+	for _, block := range message.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	resp.ID = message.ID
+	resp.Model = message.Model
+	resp.Usage = openai.Usage{
+		PromptTokens:     message.Usage.InputTokens,
+		CompletionTokens: message.Usage.OutputTokens,
+		TotalTokens:      message.Usage.InputTokens + message.Usage.OutputTokens,
+	}
+	if text.Len() > 0 {
+		resp.Choices = []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: text.String()},
+			FinishReason: openai.FinishReason(message.StopReason),
+		}}
+	}
+	return resp, nil
+}
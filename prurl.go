@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// pullURLRes match the web URL of a PR (https://github.com/octocat/hello-world/pull/42, possibly
+// followed by a tab like /files) and its API URL (https://api.github.com/repos/octocat/hello-world/pulls/42,
+// under /api/v3 on GitHub Enterprise Server)
+var pullURLRes = []*regexp.Regexp{
+	regexp.MustCompile(`^https?://[^/]+/([^/]+)/([^/]+)/pull/(\d+)(?:[/?#].*)?$`),
+	regexp.MustCompile(`^https?://[^/]+/(?:api/v3/)?repos/([^/]+)/([^/]+)/pulls/(\d+)/?$`),
+}
+
+// parsePullRequestURL extracts the owner, repository and number of a PR from its web or API URL
+func parsePullRequestURL(url string) (owner, repo string, number int, err error) {
+	for _, re := range pullURLRes {
+		if matches := re.FindStringSubmatch(url); matches != nil {
+			number, err = strconv.Atoi(matches[3])
+			if err != nil {
+				return "", "", 0, fmt.Errorf("invalid PR number in %q: %w", url, err)
+			}
+			return matches[1], matches[2], number, nil
+		}
+	}
+	return "", "", 0, fmt.Errorf("%q isn't a PR URL, expected https://github.com/<owner>/<repo>/pull/<number> or https://api.github.com/repos/<owner>/<repo>/pulls/<number>", url)
+}
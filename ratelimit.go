@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// rateLimitRetry is how GitHub calls hitting a rate limit are retried, set from -max-retries and -max-wait
+var rateLimitRetry = struct {
+	// Retries is the number of retries after the first attempt
+	Retries int
+	// MaxWait caps a single wait for the rate limit to reset
+	MaxWait time.Duration
+}{Retries: 3, MaxWait: 15 * time.Minute}
+
+// rateLimitWait returns how long to wait before retrying a call that failed on a rate limit:
+// until the reset of the primary rate limit, the Retry-After of a secondary one, or an exponential
+// backoff when GitHub didn't say. ok is false when the error isn't a rate limit.
+func rateLimitWait(err error, attempt int) (wait time.Duration, ok bool) {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		wait = time.Until(rateErr.Rate.Reset.Time) + time.Second
+		if wait <= time.Second {
+			wait = time.Second << attempt
+		}
+		return wait, true
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if retryAfter := abuseErr.GetRetryAfter(); retryAfter > 0 {
+			return retryAfter, true
+		}
+		// GitHub asks to wait at least a minute without Retry-After
+		return time.Minute << attempt, true
+	}
+	return 0, false
+}
+
+// withRateLimitRetry runs a GitHub call, retrying it when it fails on a rate limit
+func withRateLimitRetry(ctx context.Context, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+		wait, limited := rateLimitWait(err, attempt)
+		if !limited || attempt >= rateLimitRetry.Retries {
+			return err
+		}
+		if wait > rateLimitRetry.MaxWait {
+			wait = rateLimitRetry.MaxWait
+		}
+		logf(slog.LevelWarn, "GitHub rate limit hit, retrying in %s (%d/%d): %v\n", wait.Round(time.Second), attempt+1, rateLimitRetry.Retries, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
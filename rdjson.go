@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// rdSource, rdDiagnostic and rdResult follow reviewdog's Diagnostic Format (rdjson/rdjsonl),
+// see https://github.com/reviewdog/reviewdog/tree/master/proto/rdf
+type rdSource struct {
+	Name string `json:"name"`
+}
+
+type rdPosition struct {
+	Line int `json:"line"`
+}
+
+type rdRange struct {
+	Start rdPosition  `json:"start"`
+	End   *rdPosition `json:"end,omitempty"`
+}
+
+type rdLocation struct {
+	Path  string  `json:"path"`
+	Range rdRange `json:"range"`
+}
+
+type rdDiagnostic struct {
+	Message  string     `json:"message"`
+	Location rdLocation `json:"location"`
+	Severity string     `json:"severity"`
+	Source   rdSource   `json:"source"`
+}
+
+type rdResult struct {
+	Source      rdSource       `json:"source"`
+	Diagnostics []rdDiagnostic `json:"diagnostics"`
+}
+
+// rdSeverity maps a comment severity tag to a reviewdog severity
+func rdSeverity(severity string) string {
+	switch severity {
+	case "blocker", "major":
+		return "ERROR"
+	case "nit":
+		return "INFO"
+	}
+	return "WARNING"
+}
+
+// toDiagnostics converts review comments to reviewdog diagnostics, moving the severity tag to the severity field
+func toDiagnostics(comments []*github.DraftReviewComment) []rdDiagnostic {
+	diagnostics := []rdDiagnostic{}
+	for _, comment := range comments {
+		lineRange := rdRange{Start: rdPosition{Line: comment.GetLine()}}
+		if comment.GetStartLine() != 0 {
+			lineRange = rdRange{Start: rdPosition{Line: comment.GetStartLine()}, End: &rdPosition{Line: comment.GetLine()}}
+		}
+		diagnostics = append(diagnostics, rdDiagnostic{
+			Message: strings.TrimSpace(severityTagRe.ReplaceAllString(comment.GetBody(), "")),
+			Location: rdLocation{
+				Path:  comment.GetPath(),
+				Range: lineRange,
+			},
+			Severity: rdSeverity(commentSeverity(comment.GetBody())),
+			Source:   rdSource{Name: "gh-pr-reviewer"},
+		})
+	}
+	return diagnostics
+}
+
+// writeDiagnostics writes the comments in the given output format: "rdjson" writes a single
+// DiagnosticResult object, "rdjsonl" one Diagnostic object per line
+func writeDiagnostics(w io.Writer, format string, comments []*github.DraftReviewComment) error {
+	encoder := json.NewEncoder(w)
+	switch format {
+	case "rdjson":
+		return encoder.Encode(rdResult{Source: rdSource{Name: "gh-pr-reviewer"}, Diagnostics: toDiagnostics(comments)})
+	case "rdjsonl":
+		for _, diagnostic := range toDiagnostics(comments) {
+			err := encoder.Encode(diagnostic)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// remediationItemRe matches an item of an earlier remediation checklist, with the hidden location
+// and content hash of the line it was about
+var remediationItemRe = regexp.MustCompile(`^- \[[ x]\] (.*) <!-- remediation-item (\S+):(\d+):([0-9a-f]+) -->$`)
+
+// remediationItem is a blocking comment to address, tracked by the content of its line
+type remediationItem struct {
+	Text string
+	Path string
+	Line int
+	Hash string
+}
+
+// lineHash fingerprints the content of a line so later runs can tell whether it changed
+func lineHash(content string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(content)))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// previousRemediationItems returns the items of the remediation checklist of the tool's latest review
+func previousRemediationItems(ctx context.Context, client *github.Client, owner, repo string, prNumber int) ([]remediationItem, error) {
+	reviews, err := listReviews(client, ctx, owner, repo, prNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []remediationItem
+	for i := len(reviews) - 1; i >= 0; i-- {
+		body := reviews[i].GetBody()
+		if !strings.Contains(body, commentMarker) || !strings.Contains(body, "<!-- remediation-item ") {
+			continue
+		}
+		for _, line := range strings.Split(body, "\n") {
+			matches := remediationItemRe.FindStringSubmatch(strings.TrimSpace(line))
+			if matches == nil {
+				continue
+			}
+			lineNumber, _ := strconv.Atoi(matches[3])
+			items = append(items, remediationItem{Text: matches[1], Path: matches[2], Line: lineNumber, Hash: matches[4]})
+		}
+		break
+	}
+	return items, nil
+}
+
+// renderRemediationChecklist renders the blocking comments as a task list linking to their lines.
+// Items of the previous checklist that aren't flagged again are carried over, pre-checked when
+// their line has changed since.
+func renderRemediationChecklist(pr *github.PullRequest, blocking []*github.DraftReviewComment, previous []remediationItem, files []*github.CommitFile) string {
+	lines := make(map[string]map[int]string)
+	for _, file := range files {
+		lines[file.GetFilename()] = commentableLines(file.GetPatch())
+	}
+
+	current := make(map[string]bool)
+	var items []string
+	for _, comment := range blocking {
+		content := lines[comment.GetPath()][comment.GetLine()]
+		item := remediationItem{
+			Text: fmt.Sprintf("[`%s:%d`](%s) %s", comment.GetPath(), comment.GetLine(), commentLink(pr, comment), firstLine(comment.GetBody())),
+			Path: comment.GetPath(),
+			Line: comment.GetLine(),
+			Hash: lineHash(content),
+		}
+		current[fmt.Sprintf("%s:%d:%s", item.Path, item.Line, item.Hash)] = true
+		items = append(items, renderRemediationItem(item, false))
+	}
+
+	for _, item := range previous {
+		if current[fmt.Sprintf("%s:%d:%s", item.Path, item.Line, item.Hash)] {
+			continue
+		}
+		content, ok := lines[item.Path][item.Line]
+		changed := !ok || lineHash(content) != item.Hash
+		items = append(items, renderRemediationItem(item, changed))
+	}
+
+	if len(items) == 0 {
+		return ""
+	}
+	return "### Changes Requested\n\n" + strings.Join(items, "\n")
+}
+
+// renderRemediationItem renders a task list item, keeping the hidden fingerprint of its line
+func renderRemediationItem(item remediationItem, done bool) string {
+	box := "[ ]"
+	if done {
+		box = "[x]"
+	}
+	return fmt.Sprintf("- %s %s <!-- remediation-item %s:%d:%s -->", box, item.Text, item.Path, item.Line, item.Hash)
+}
+
+// firstLine returns the first line of a comment, task list items can't span lines
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
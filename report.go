@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// writeBatchReport writes a markdown table of every reviewed PR with its verdict, comment count and cost
+func writeBatchReport(path string, outcomes []*reviewOutcome) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# PR Review Report\n\n")
+	fmt.Fprintf(&b, "Generated %s\n\n", time.Now().Format("2006-01-02 15:04 MST"))
+	fmt.Fprintf(&b, "| PR | Title | Verdict | Comments | Tokens | Cost |\n")
+	fmt.Fprintf(&b, "|----|-------|---------|----------|--------|------|\n")
+
+	var totalComments, totalTokens int
+	var totalCost float64
+	verdicts := make(map[string]int)
+	for _, outcome := range outcomes {
+		verdict := outcome.State
+		switch {
+		case outcome.Err != nil:
+			verdict = "error"
+		case verdict == "":
+			verdict = "skipped"
+		case !outcome.Posted:
+			verdict += " (dry run)"
+		}
+		verdicts[verdict]++
+
+		pr := fmt.Sprintf("%s/%s#%d", outcome.Owner, outcome.Repo, outcome.Number)
+		if outcome.URL != "" {
+			pr = fmt.Sprintf("[%s](%s)", pr, outcome.URL)
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %d | %d | $%.4f |\n",
+			pr, escapeTableCell(outcome.Title), verdict, outcome.Comments, outcome.Usage.TotalTokens, outcome.Cost)
+
+		totalComments += outcome.Comments
+		totalTokens += outcome.Usage.TotalTokens
+		totalCost += outcome.Cost
+	}
+	fmt.Fprintf(&b, "| **Total** | %d PRs | | %d | %d | $%.4f |\n", len(outcomes), totalComments, totalTokens, totalCost)
+
+	var names []string
+	for verdict := range verdicts {
+		names = append(names, verdict)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(&b, "\n## Verdicts\n\n")
+	for _, verdict := range names {
+		fmt.Fprintf(&b, "- %s: %d\n", verdict, verdicts[verdict])
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// escapeTableCell keeps text from breaking a markdown table row
+func escapeTableCell(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "|", "\\|"), "\n", " ")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// repoOverride holds the settings of the config file's repos section that replace the global ones
+// for a single repo. Unset fields keep the global value.
+type repoOverride struct {
+	Model string `yaml:"model"`
+	// Dry can only turn dry-run mode on
+	Dry *bool `yaml:"dry"`
+	// Ignore lists globs added to the global ignore list
+	Ignore         []string          `yaml:"ignore"`
+	SeverityEvents map[string]string `yaml:"severity_events"`
+	ApprovalPolicy *approvalPolicy   `yaml:"approval_policy"`
+}
+
+// validateRepoOverrides checks the repo keys, globs and severity mappings of the repos section
+func validateRepoOverrides(repos map[string]repoOverride, path string) error {
+	for name, override := range repos {
+		if owner, repo, ok := strings.Cut(name, "/"); !ok || owner == "" || repo == "" {
+			return fmt.Errorf("invalid repo %q in the repos section of %s, expected <owner>/<repo>", name, path)
+		}
+		for _, pattern := range override.Ignore {
+			if !doublestar.ValidatePattern(pattern) {
+				return fmt.Errorf("invalid glob %q in the ignore list of %s in %s", pattern, name, path)
+			}
+		}
+		if _, err := parseSeverityEvents(severityEventsValue(override.SeverityEvents)); err != nil {
+			return fmt.Errorf("invalid severity_events of %s in %s: %w", name, path, err)
+		}
+		if override.ApprovalPolicy != nil {
+			for _, condition := range override.ApprovalPolicy.Conditions {
+				for _, pattern := range condition.Paths {
+					if !doublestar.ValidatePattern(pattern) {
+						return fmt.Errorf("invalid glob %q in approval condition %q of %s in %s", pattern, condition.Name, name, path)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// severityEventsValue renders a severity mapping in the -severity-events syntax
+func severityEventsValue(events map[string]string) string {
+	var entries []string
+	for severity, event := range events {
+		entries = append(entries, severity+"="+event)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// forRepo returns the options to review a PR of owner/repo with, the global ones with the repo's
+// override from the config file applied. Repos without an override use the global options.
+func (opts runOptions) forRepo(owner, repo string) runOptions {
+	var override repoOverride
+	found := false
+	for name, o := range opts.RepoOverrides {
+		if strings.EqualFold(name, owner+"/"+repo) {
+			override, found = o, true
+			break
+		}
+	}
+	if !found {
+		return opts
+	}
+	logf(slog.LevelInfo, "Applying the config overrides of %s/%s.\n", owner, repo)
+
+	if override.Model != "" {
+		// the global chain stays as the fallback
+		opts.Completion.Models = modelChain(opts.Completion.Provider, override.Model, strings.Join(opts.Completion.Models, ","))
+	}
+	if override.Dry != nil && *override.Dry {
+		// an override can't turn off a dry run asked for globally
+		opts.DryRun = true
+	}
+	if len(override.Ignore) > 0 {
+		opts.IgnoreGlobs = append(append([]string{}, opts.IgnoreGlobs...), override.Ignore...)
+	}
+	if len(override.SeverityEvents) > 0 {
+		// validated when the config was loaded
+		opts.SeverityEvents, _ = parseSeverityEvents(severityEventsValue(override.SeverityEvents))
+	}
+	if override.ApprovalPolicy != nil {
+		opts.ApprovalPolicy = override.ApprovalPolicy
+	}
+	return opts
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// checksPollInterval is how often the checks are listed again while waiting for them to complete
+const checksPollInterval = 30 * time.Second
+
+// requiredChecks returns the names of the checks that gate an approval on the branch: the configured list
+// when set, otherwise the required status checks of the branch protection. nil means every check counts.
+func requiredChecks(ctx context.Context, client *github.Client, owner, repo, branch string, configured []string) []string {
+	if len(configured) > 0 {
+		return configured
+	}
+
+	var protection *github.Protection
+	err := withRateLimitRetry(ctx, func() (err error) {
+		protection, _, err = client.Repositories.GetBranchProtection(ctx, owner, repo, branch)
+		return err
+	})
+	if err != nil {
+		// reading the protection takes admin access, without it every check counts
+		if !errors.Is(err, github.ErrBranchNotProtected) {
+			logf(slog.LevelError, "Error fetching the protection of %s, every check counts: %v\n", branch, err)
+		}
+		return nil
+	}
+	if protection.RequiredStatusChecks == nil {
+		return nil
+	}
+
+	var required []string
+	for _, check := range protection.RequiredStatusChecks.Checks {
+		required = append(required, check.Context)
+	}
+	if len(required) == 0 {
+		required = protection.RequiredStatusChecks.Contexts
+	}
+	return required
+}
+
+// requiredChecksPassed reports whether none of the failed checks is required, or whether no check failed
+// when there are no required checks
+func requiredChecksPassed(failed, required []string) bool {
+	if len(required) == 0 {
+		return len(failed) == 0
+	}
+	isRequired := make(map[string]bool)
+	for _, name := range required {
+		isRequired[name] = true
+	}
+	for _, name := range failed {
+		if isRequired[name] {
+			return false
+		}
+		logf(slog.LevelInfo, "The optional check %s failed, it doesn't block the approval.\n", name)
+	}
+	return true
+}
+
+// gatingChecks keeps the checks that are required, or all of them when there are no required checks
+func gatingChecks(names, required []string) []string {
+	if len(required) == 0 {
+		return names
+	}
+	isRequired := make(map[string]bool)
+	for _, name := range required {
+		isRequired[name] = true
+	}
+	var gating []string
+	for _, name := range names {
+		if isRequired[name] {
+			gating = append(gating, name)
+		}
+	}
+	return gating
+}
+
+// pendingChecksNote explains why an approval was downgraded to a comment
+func pendingChecksNote(pending []string) string {
+	return fmt.Sprintf("> **Checks still running:** this PR isn't approved before `%s` complete.", strings.Join(pending, "`, `"))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// SavedFile records the patch a saved review was generated from, to tell which files changed since
+type SavedFile struct {
+	Filename  string `json:"filename"`
+	PatchHash string `json:"patch_hash"`
+	// Clean is true when the review found no issue in the file
+	Clean bool `json:"clean"`
+}
+
+// patchHash returns a short fingerprint of a file's patch
+func patchHash(file *github.CommitFile) string {
+	sum := sha256.Sum256([]byte(file.GetPatch()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// savedFiles fingerprints the reviewed files for the saved review, marking those without comments as clean
+func savedFiles(files []*github.CommitFile, comments []*github.DraftReviewComment) []SavedFile {
+	commented := make(map[string]bool)
+	for _, comment := range comments {
+		commented[comment.GetPath()] = true
+	}
+
+	var saved []SavedFile
+	for _, file := range files {
+		saved = append(saved, SavedFile{Filename: file.GetFilename(), PatchHash: patchHash(file), Clean: !commented[file.GetFilename()]})
+	}
+	return saved
+}
+
+// carriedFiles returns the previous review's records of the named files, which this review carries over
+// without sending them to the model again
+func carriedFiles(previous *SavedReview, names []string) []SavedFile {
+	carried := make(map[string]bool)
+	for _, name := range names {
+		carried[name] = true
+	}
+
+	var saved []SavedFile
+	for _, file := range previous.Files {
+		if carried[file.Filename] {
+			saved = append(saved, file)
+		}
+	}
+	return saved
+}
+
+// findPreviousReview returns the most recently saved review of the PR made at another head SHA
+// that records its files, or nil when there is none. The file name only has the repository's name,
+// which other repositories' names may start with, so the saved owner and repository must match.
+func findPreviousReview(dir, owner, repo string, prNumber int, headSHA string) *SavedReview {
+	paths, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%s-*-review.json", repo)))
+	if err != nil {
+		return nil
+	}
+
+	var previous *SavedReview
+	var previousTime int64
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || (previous != nil && info.ModTime().UnixNano() <= previousTime) {
+			continue
+		}
+		saved, err := loadReviewFromFile(path)
+		if err != nil || saved.Owner != owner || saved.Repo != repo || saved.PRNumber != prNumber || saved.HeadSHA == headSHA || len(saved.Files) == 0 {
+			continue
+		}
+		previous, previousTime = saved, info.ModTime().UnixNano()
+	}
+	return previous
+}
+
+// selectChangedFiles splits the files into those whose patch changed since the previous review and
+// those it already reviewed unchanged, and returns the previous comments on the unchanged ones
+func selectChangedFiles(files []*github.CommitFile, previous *SavedReview) (changed []*github.CommitFile, unchanged []string, reused []*github.DraftReviewComment) {
+	hashes := make(map[string]string)
+	for _, file := range previous.Files {
+		hashes[file.Filename] = file.PatchHash
+	}
+
+	isUnchanged := make(map[string]bool)
+	for _, file := range files {
+		if hash, ok := hashes[file.GetFilename()]; ok && hash == patchHash(file) {
+			unchanged = append(unchanged, file.GetFilename())
+			isUnchanged[file.GetFilename()] = true
+		} else {
+			changed = append(changed, file)
+		}
+	}
+
+	for _, comment := range previous.ReviewComments {
+		if isUnchanged[comment.GetPath()] {
+			reused = append(reused, comment)
+		}
+	}
+	logf(slog.LevelInfo, "Re-reviewing %d changed files, reusing %d comments on %d files unchanged since %s.\n", len(changed), len(reused), len(unchanged), previous.HeadSHA)
+	return changed, unchanged, reused
+}
+
+// skipCleanFiles removes the files the previous review found no issue in and that haven't changed since
+func skipCleanFiles(files []*github.CommitFile, previous *SavedReview) (remaining []*github.CommitFile, skipped []string) {
+	clean := make(map[string]string)
+	for _, file := range previous.Files {
+		if file.Clean {
+			clean[file.Filename] = file.PatchHash
+		}
+	}
+
+	for _, file := range files {
+		if hash, ok := clean[file.GetFilename()]; ok && hash == patchHash(file) {
+			skipped = append(skipped, file.GetFilename())
+		} else {
+			remaining = append(remaining, file)
+		}
+	}
+	logf(slog.LevelInfo, "Skipping %d files found clean in the review of %s and unchanged since.\n", len(skipped), previous.HeadSHA)
+	return remaining, skipped
+}
+
+// mergeComments combines the new and the reused comments, ordered by file and line
+func mergeComments(comments, reused []*github.DraftReviewComment) []*github.DraftReviewComment {
+	merged := append(append([]*github.DraftReviewComment{}, comments...), reused...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].GetPath() != merged[j].GetPath() {
+			return merged[i].GetPath() < merged[j].GetPath()
+		}
+		return merged[i].GetLine() < merged[j].GetLine()
+	})
+	return merged
+}
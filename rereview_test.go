@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+)
+
+func TestCarriedFiles(t *testing.T) {
+	previous := &SavedReview{Files: []SavedFile{
+		{Filename: "a.go", PatchHash: "1", Clean: true},
+		{Filename: "b.go", PatchHash: "2"},
+		{Filename: "c.go", PatchHash: "3", Clean: true},
+	}}
+
+	got := carriedFiles(previous, []string{"c.go", "b.go", "d.go"})
+	want := []SavedFile{{Filename: "b.go", PatchHash: "2"}, {Filename: "c.go", PatchHash: "3", Clean: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want the previous records of the carried files", got)
+	}
+}
+
+func TestSavedFilesCleanness(t *testing.T) {
+	files := []*github.CommitFile{
+		{Filename: github.String("a.go"), Patch: github.String("@@ -1 +1 @@\n-a\n+b")},
+		{Filename: github.String("b.go"), Patch: github.String("@@ -1 +1 @@\n-c\n+d")},
+	}
+	comments := []*github.DraftReviewComment{{Path: github.String("b.go"), Line: github.Int(1), Body: github.String("[minor] Typo")}}
+
+	saved := savedFiles(files, comments)
+	if len(saved) != 2 || !saved[0].Clean || saved[1].Clean {
+		t.Fatalf("got %v, want a.go clean and b.go with an issue", saved)
+	}
+	if saved[0].PatchHash != patchHash(files[0]) || saved[0].PatchHash == saved[1].PatchHash {
+		t.Errorf("got hashes %s and %s, want the fingerprints of the patches", saved[0].PatchHash, saved[1].PatchHash)
+	}
+}
+
+func TestFindPreviousReviewMatchesTheRepository(t *testing.T) {
+	dir := t.TempDir()
+	files := []SavedFile{{Filename: "main.go", PatchHash: "1"}}
+	for name, saved := range map[string]SavedReview{
+		"api-old-review.json":           {Owner: "octocat", Repo: "api", PRNumber: 7, HeadSHA: "old", Files: files},
+		"api-gateway-gw-review.json":    {Owner: "octocat", Repo: "api-gateway", PRNumber: 7, HeadSHA: "gw", Files: files},
+		"api-fork-review.json":          {Owner: "someone", Repo: "api", PRNumber: 7, HeadSHA: "fork", Files: files},
+		"api-unowned-review.json":       {PRNumber: 7, HeadSHA: "unowned", Files: files},
+		"api-otherpr-review.json":       {Owner: "octocat", Repo: "api", PRNumber: 8, HeadSHA: "otherpr", Files: files},
+		"api-current-review.json":       {Owner: "octocat", Repo: "api", PRNumber: 7, HeadSHA: "current", Files: files},
+		"api-without-files-review.json": {Owner: "octocat", Repo: "api", PRNumber: 7, HeadSHA: "without"},
+	} {
+		if err := saveReviewToFile(filepath.Join(dir, name), "Review", saved); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	previous := findPreviousReview(dir, "octocat", "api", 7, "current")
+	if previous == nil || previous.HeadSHA != "old" {
+		t.Errorf("got %+v, want the review of octocat/api#7 at old", previous)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// positivePhrases and negativePhrases hint at the verdict of a response that lacks a recommendation marker.
+// The negative phrases are counted first and removed, so "not ready to merge" doesn't also count as "ready to merge".
+var (
+	positivePhrases = compilePhrases(`looks good`, `lgtm`, `well[ -](done|written|structured)`, `no (major )?issues`, `ready to merge`,
+		`good to merge`, `can be merged`, `recommend approv\w*`, `clean implementation`)
+	negativePhrases = compilePhrases(`(must|should|needs to) be fixed`, `bugs?`, `vulnerab(le|ility|ilities)`, `security (issue|hole|flaw)s?`,
+		`incorrect(ly)?`, `will panic`, `race conditions?`, `data loss`, `breaks`, `not (yet )?ready`, `(can't|cannot|can not|should not|shouldn't) be merged`,
+		`(doesn't|does not|don't|do not) look good`, `request(ing)? changes`, `requires changes`, `critical`)
+)
+
+// neutralPhrasesRe matches the phrases that contain a negative phrase without being negative: negations
+// such as "no bugs found" and "without any security issues", and "line breaks"
+var neutralPhrasesRe = regexp.MustCompile(`\b((no|not|without|free of|any|zero)\s+(obvious |major |critical |known |new |other |potential )?(bugs?|vulnerabilit(y|ies)|security (issue|hole|flaw)s?|race conditions?|data loss|critical issues?)|(line|page) breaks)\b`)
+
+// compilePhrases compiles the phrases into regexes matching them as whole words
+func compilePhrases(phrases ...string) []*regexp.Regexp {
+	var compiled []*regexp.Regexp
+	for _, phrase := range phrases {
+		compiled = append(compiled, regexp.MustCompile(`\b`+phrase+`\b`))
+	}
+	return compiled
+}
+
+// inferAction guesses the recommendation from the tone of a response: "approve" or "request_changes"
+// when one side clearly dominates, "" when the tone is inconclusive
+func inferAction(responseText string) string {
+	lower := neutralPhrasesRe.ReplaceAllString(strings.ToLower(responseText), " ")
+	score := 0
+	for _, re := range negativePhrases {
+		score -= len(re.FindAllStringIndex(lower, -1))
+		lower = re.ReplaceAllString(lower, " ")
+	}
+	for _, re := range positivePhrases {
+		score += len(re.FindAllStringIndex(lower, -1))
+	}
+
+	switch {
+	case score >= 2:
+		return "approve"
+	case score <= -2:
+		return "request_changes"
+	}
+	return ""
+}
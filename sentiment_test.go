@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestInferAction(t *testing.T) {
+	tests := []struct {
+		response, want string
+	}{
+		{"Looks good overall, the code is well structured. LGTM.", "approve"},
+		{"No bugs found, no security issues either. Looks good and ready to merge.", "approve"},
+		{"I added debug logging and the line breaks are consistent. Looks good, well written.", "approve"},
+		{"This change has a bug: it will panic on empty input, and the race condition must be fixed.", "request_changes"},
+		{"Not ready to merge: the retry loop is incorrect and breaks the existing callers.", "request_changes"},
+		{"The change renames a variable.", ""},
+		{"Looks good, but there is a bug in the parser.", ""},
+	}
+	for _, test := range tests {
+		if got := inferAction(test.response); got != test.want {
+			t.Errorf("inferAction(%q) = %q, want %q", test.response, got, test.want)
+		}
+	}
+}
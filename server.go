@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// webhookQueueSize is how many reviews can wait for the one in progress before events are refused
+const webhookQueueSize = 100
+
+// The webhook server's timeouts keep slow or stalled clients from holding connections open. Reviews run
+// after the event is acknowledged, so no request takes long to serve.
+const (
+	webhookReadHeaderTimeout = 10 * time.Second
+	webhookReadTimeout       = 30 * time.Second
+	webhookWriteTimeout      = 30 * time.Second
+	webhookIdleTimeout       = 2 * time.Minute
+)
+
+// maxWebhookPayload is the size of the largest event GitHub sends
+const maxWebhookPayload = 25 << 20
+
+// reviewJob is a PR to review, extracted from a webhook event
+type reviewJob struct {
+	Owner  string
+	Repo   string
+	Number int
+}
+
+// webhookServer reviews the PRs of the pull_request events GitHub sends it. Up to maxConcurrent reviews
+// run in the background, the others wait in the queue, and a PR pushed twice in a row isn't reviewed
+// concurrently.
+type webhookServer struct {
+	client        *github.Client
+	opts          runOptions
+	secret        []byte
+	statsDB       string
+	maxConcurrent int
+	// debounce is the quiet period after a PR's last event before it's queued, 0 queues it right away
+	debounce time.Duration
+	jobs     chan reviewJob
+
+	// inFlight is the number of reviews in progress
+	inFlight atomic.Int64
+	// reviewed and reviewSeconds are the number of finished reviews and their total duration
+	reviewed      atomic.Int64
+	reviewSeconds atomic.Uint64 // float64 bits
+
+	mu sync.Mutex
+	// prLocks serializes the reviews of each PR, while some are queued or running
+	prLocks map[reviewJob]*prLock
+	// statsMu serializes the writes to the stats file
+	statsMu sync.Mutex
+	// timers holds the pending debounce timer of each PR
+	timers map[reviewJob]*time.Timer
+}
+
+// prLock is held by the review of a PR, users counts the reviews running or waiting for it
+type prLock struct {
+	sync.Mutex
+	users int
+}
+
+// serve listens for webhook events on addr until the server fails
+func serve(ctx context.Context, client *github.Client, opts runOptions, addr, secret, statsDB string, maxConcurrent int, debounce time.Duration) error {
+	if secret == "" {
+		return fmt.Errorf("GITHUB_WEBHOOK_SECRET must be set, unsigned events are never accepted")
+	}
+	if maxConcurrent < 1 {
+		return fmt.Errorf("-max-concurrent-reviews must be at least 1")
+	}
+	server := newWebhookServer(client, opts, secret, statsDB, maxConcurrent)
+	server.debounce = debounce
+	for i := 0; i < maxConcurrent; i++ {
+		go server.work(ctx)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/webhook", server)
+	mux.HandleFunc("/metrics", server.serveMetrics)
+	logf(slog.LevelInfo, "Listening for GitHub webhook events on %s/webhook, metrics on %s/metrics\n", addr, addr)
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: webhookReadHeaderTimeout,
+		ReadTimeout:       webhookReadTimeout,
+		WriteTimeout:      webhookWriteTimeout,
+		IdleTimeout:       webhookIdleTimeout,
+	}
+	return httpServer.ListenAndServe()
+}
+
+func newWebhookServer(client *github.Client, opts runOptions, secret, statsDB string, maxConcurrent int) *webhookServer {
+	return &webhookServer{
+		client:        client,
+		opts:          opts,
+		secret:        []byte(secret),
+		statsDB:       statsDB,
+		maxConcurrent: maxConcurrent,
+		jobs:          make(chan reviewJob, webhookQueueSize),
+		prLocks:       make(map[reviewJob]*prLock),
+		timers:        make(map[reviewJob]*time.Timer),
+	}
+}
+
+// ServeHTTP checks the event's signature and queues the review of the PR it's about
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxWebhookPayload)
+	// checks X-Hub-Signature-256 against the secret
+	payload, err := github.ValidatePayload(r, s.secret)
+	if err != nil {
+		logf(slog.LevelWarn, "Rejected a webhook event: %v\n", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	event, err := github.ParseWebHook(github.WebHookType(r), payload)
+	if err != nil {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	job, ok := pullRequestJob(event)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if s.debounce > 0 {
+		s.schedule(job)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if !s.enqueue(job) {
+		http.Error(w, "too many pending reviews", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// enqueue queues the review of the PR, it reports false when the queue is full
+func (s *webhookServer) enqueue(job reviewJob) bool {
+	select {
+	case s.jobs <- job:
+		logf(slog.LevelInfo, "Queued the review of %s/%s#%d\n", job.Owner, job.Repo, job.Number)
+		return true
+	default:
+		logf(slog.LevelWarn, "Review queue full, dropping the event of %s/%s#%d\n", job.Owner, job.Repo, job.Number)
+		return false
+	}
+}
+
+// schedule queues the review of the PR once no event about it arrived for the debounce period,
+// so a burst of pushes is reviewed once. Each event restarts the PR's timer.
+func (s *webhookServer) schedule(job reviewJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if timer, ok := s.timers[job]; ok && timer.Stop() {
+		timer.Reset(s.debounce)
+		logf(slog.LevelDebug, "Postponed the review of %s/%s#%d by %s\n", job.Owner, job.Repo, job.Number, s.debounce)
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(s.debounce, func() {
+		s.mu.Lock()
+		// a later event may have replaced the timer while this one was firing
+		if s.timers[job] == timer {
+			delete(s.timers, job)
+		}
+		s.mu.Unlock()
+		s.enqueue(job)
+	})
+	s.timers[job] = timer
+	logf(slog.LevelInfo, "Reviewing %s/%s#%d after %s without new events\n", job.Owner, job.Repo, job.Number, s.debounce)
+}
+
+// pullRequestJob returns the PR to review for the events opening a PR or pushing to it
+func pullRequestJob(event interface{}) (reviewJob, bool) {
+	e, ok := event.(*github.PullRequestEvent)
+	if !ok || (e.GetAction() != "opened" && e.GetAction() != "synchronize") {
+		return reviewJob{}, false
+	}
+	return reviewJob{
+		Owner:  e.GetRepo().GetOwner().GetLogin(),
+		Repo:   e.GetRepo().GetName(),
+		Number: e.GetPullRequest().GetNumber(),
+	}, true
+}
+
+// work reviews the queued PRs one at a time, each worker taking the next one
+func (s *webhookServer) work(ctx context.Context) {
+	for job := range s.jobs {
+		s.review(ctx, job)
+	}
+}
+
+// review reviews a PR once the reviews of the same PR already in progress are done
+func (s *webhookServer) review(ctx context.Context, job reviewJob) {
+	s.mu.Lock()
+	lock, ok := s.prLocks[job]
+	if !ok {
+		lock = &prLock{}
+		s.prLocks[job] = lock
+	}
+	lock.users++
+	s.mu.Unlock()
+
+	lock.Lock()
+	defer func() {
+		lock.Unlock()
+		s.mu.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(s.prLocks, job)
+		}
+		s.mu.Unlock()
+	}()
+
+	s.inFlight.Add(1)
+	start := time.Now()
+	outcome, err := reviewPullRequestWithDeadline(ctx, s.client, s.opts, job.Owner, job.Repo, job.Number)
+	s.inFlight.Add(-1)
+	s.recordDuration(time.Since(start))
+
+	if err != nil {
+		logf(slog.LevelError, "Error reviewing %s/%s#%d: %v\n", job.Owner, job.Repo, job.Number, err)
+	} else {
+		logf(slog.LevelInfo, "Reviewed %s/%s#%d: %s\n", job.Owner, job.Repo, job.Number, outcome.State)
+	}
+	if s.statsDB != "" {
+		s.statsMu.Lock()
+		if err := appendStats(s.statsDB, []*reviewOutcome{outcome}); err != nil {
+			logf(slog.LevelError, "Error recording stats: %v\n", err)
+		}
+		s.statsMu.Unlock()
+	}
+}
+
+// recordDuration adds a finished review to the latency metrics
+func (s *webhookServer) recordDuration(d time.Duration) {
+	s.reviewed.Add(1)
+	for {
+		old := s.reviewSeconds.Load()
+		total := math.Float64frombits(old) + d.Seconds()
+		if s.reviewSeconds.CompareAndSwap(old, math.Float64bits(total)) {
+			return
+		}
+	}
+}
+
+// serveMetrics reports the reviews in progress, the queued ones and the review latency in the Prometheus text format
+func (s *webhookServer) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP gh_pr_reviewer_reviews_in_flight Reviews in progress.\n# TYPE gh_pr_reviewer_reviews_in_flight gauge\ngh_pr_reviewer_reviews_in_flight %d\n", s.inFlight.Load())
+	fmt.Fprintf(w, "# HELP gh_pr_reviewer_reviews_queued Reviews waiting for a free slot.\n# TYPE gh_pr_reviewer_reviews_queued gauge\ngh_pr_reviewer_reviews_queued %d\n", len(s.jobs))
+	fmt.Fprintf(w, "# HELP gh_pr_reviewer_max_concurrent_reviews Reviews allowed to run at once.\n# TYPE gh_pr_reviewer_max_concurrent_reviews gauge\ngh_pr_reviewer_max_concurrent_reviews %d\n", s.maxConcurrent)
+	fmt.Fprintf(w, "# HELP gh_pr_reviewer_review_duration_seconds Time spent on finished reviews.\n# TYPE gh_pr_reviewer_review_duration_seconds summary\ngh_pr_reviewer_review_duration_seconds_sum %g\ngh_pr_reviewer_review_duration_seconds_count %d\n", math.Float64frombits(s.reviewSeconds.Load()), s.reviewed.Load())
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeMetrics(t *testing.T) {
+	server := newWebhookServer(nil, runOptions{}, "secret", "", 2)
+	server.inFlight.Add(1)
+	server.jobs <- reviewJob{Owner: "octocat", Repo: "hello", Number: 7}
+	server.recordDuration(1500 * time.Millisecond)
+	server.recordDuration(500 * time.Millisecond)
+
+	recorder := httptest.NewRecorder()
+	server.serveMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+	for _, want := range []string{
+		"gh_pr_reviewer_reviews_in_flight 1\n",
+		"gh_pr_reviewer_reviews_queued 1\n",
+		"gh_pr_reviewer_max_concurrent_reviews 2\n",
+		"gh_pr_reviewer_review_duration_seconds_sum 2\n",
+		"gh_pr_reviewer_review_duration_seconds_count 2\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics %q don't contain %q", body, want)
+		}
+	}
+}
+
+func TestScheduleDebouncesEvents(t *testing.T) {
+	server := newWebhookServer(nil, runOptions{}, "secret", "", 1)
+	server.debounce = 50 * time.Millisecond
+	job := reviewJob{Owner: "octocat", Repo: "hello", Number: 7}
+
+	server.schedule(job)
+	for i := 0; i < 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+		server.schedule(job)
+	}
+	if len(server.jobs) != 0 {
+		t.Fatal("the PR was queued while it kept receiving events")
+	}
+
+	select {
+	case queued := <-server.jobs:
+		if queued != job {
+			t.Errorf("queued %v, want %v", queued, job)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the PR wasn't queued after the quiet period")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if len(server.jobs) != 0 {
+		t.Errorf("the PR's events were reviewed %d more times, want one review", len(server.jobs))
+	}
+
+	// each PR has its own timer
+	other := reviewJob{Owner: "octocat", Repo: "hello", Number: 8}
+	server.schedule(job)
+	server.schedule(other)
+	time.Sleep(200 * time.Millisecond)
+	if len(server.jobs) != 2 {
+		t.Errorf("got %d queued reviews, want one per PR", len(server.jobs))
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// severities lists the comment severities from most to least serious
+var severities = []string{"blocker", "major", "minor", "nit"}
+
+// defaultSeverityEvents is the default contribution of each severity to the review event
+const defaultSeverityEvents = "blocker=request_changes,major=request_changes,minor=comment,nit=comment"
+
+// severityTagRe matches the "[severity]" tag the model puts at the start of a comment,
+// with the severity icon in front of it when icons are enabled
+var severityTagRe = regexp.MustCompile(`(?i)^\s*(?:[^\s\[]{1,16}\s+)?\[(blocker|major|minor|nit)\]`)
+
+// commentSeverity returns the severity tagged on a comment body, or "" when untagged
+func commentSeverity(body string) string {
+	matches := severityTagRe.FindStringSubmatch(body)
+	if matches == nil {
+		return ""
+	}
+	return strings.ToLower(matches[1])
+}
+
+// parseSeverityEvents parses a mapping like "blocker=request_changes,nit=comment".
+// Severities missing from the value keep their default contribution.
+func parseSeverityEvents(value string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, entry := range strings.Split(defaultSeverityEvents+","+value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		severity, event, ok := strings.Cut(entry, "=")
+		severity, event = strings.ToLower(strings.TrimSpace(severity)), strings.ToLower(strings.TrimSpace(event))
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %q, expected <severity>=<event>", entry)
+		}
+		if !isSeverity(severity) {
+			return nil, fmt.Errorf("unknown severity %q, expected one of %s", severity, strings.Join(severities, ", "))
+		}
+		if event != "request_changes" && event != "comment" {
+			return nil, fmt.Errorf("invalid event %q for severity %s, expected request_changes or comment", event, severity)
+		}
+		mapping[severity] = event
+	}
+	return mapping, nil
+}
+
+// isSeverity reports whether s is a known severity
+func isSeverity(s string) bool {
+	for _, severity := range severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// blockingComments returns the comments whose severity maps to request_changes
+func blockingComments(comments []*github.DraftReviewComment, mapping map[string]string) []*github.DraftReviewComment {
+	var blocking []*github.DraftReviewComment
+	for _, comment := range comments {
+		if mapping[commentSeverity(comment.GetBody())] == "request_changes" {
+			blocking = append(blocking, comment)
+		}
+	}
+	return blocking
+}
+
+// hasSeverityTags reports whether any comment carries a severity tag
+func hasSeverityTags(comments []*github.DraftReviewComment) bool {
+	for _, comment := range comments {
+		if commentSeverity(comment.GetBody()) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// reviewEvent computes the review event from the checks, the severity policy and the model's recommendation.
+//
+// Precedence: failing checks always request changes. Otherwise, any comment whose severity maps to
+// request_changes requests changes. A "comment" action (nothing was reviewed) is kept as is.
+// When the comments are tagged but none is blocking, a request_changes recommendation is
+// downgraded to COMMENT. Untagged reviews fall back to the model's recommendation.
+func reviewEvent(action string, checksPassed bool, comments []*github.DraftReviewComment, mapping map[string]string) string {
+	if !checksPassed {
+		return "REQUEST_CHANGES"
+	}
+	if len(blockingComments(comments, mapping)) > 0 {
+		return "REQUEST_CHANGES"
+	}
+	if action == "approve" {
+		return "APPROVE"
+	}
+	if action == "comment" {
+		return "COMMENT"
+	}
+	if hasSeverityTags(comments) {
+		return "COMMENT"
+	}
+	return "REQUEST_CHANGES"
+}
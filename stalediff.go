@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// invalidPositionRe matches the errors GitHub returns for a review comment on a line, a path or a position
+// that isn't part of the PR's diff, e.g. "Line could not be resolved" or
+// "pull_request_review_thread.line must be part of the diff"
+var invalidPositionRe = regexp.MustCompile(`(?i)^(?:(?:line|path|position|start_line) could not be resolved|pull_request_review_thread\.(?:line|start_line|path|position|diff_hunk|base) .*(?:part of the diff|part of the same hunk|is invalid|can't be blank))`)
+
+// isInvalidPositionError reports whether GitHub rejected a review because some comments target
+// lines that aren't part of the PR's current diff. The errors of the response are matched, not
+// its whole text, which also holds the URL.
+func isInvalidPositionError(err error) bool {
+	var ghErr *github.ErrorResponse
+	if !errors.As(err, &ghErr) || ghErr.Response == nil || ghErr.Response.StatusCode != 422 {
+		return false
+	}
+	for _, e := range ghErr.Errors {
+		if invalidPositionRe.MatchString(strings.TrimSpace(e.Message)) {
+			return true
+		}
+	}
+	return false
+}
+
+// postReviewRetryingStaleDiff posts the review and, when the PR was updated since its files were fetched
+// and GitHub rejects the comment positions, re-maps the comments to the current diff and retries once
+func postReviewRetryingStaleDiff(client *github.Client, ctx context.Context, owner, repo string, prNumber int, review string, comments []*github.DraftReviewComment, files []*github.CommitFile, state string, opts postOptions) error {
+	err := postReviewWithComments(client, ctx, owner, repo, prNumber, review, positionComments(comments, files), state, opts)
+	if err == nil || !isInvalidPositionError(err) {
+		return err
+	}
+
+	logf(slog.LevelWarn, "GitHub rejected the comment positions, the PR was probably updated during the review: %v\n", err)
+	current, fetchErr := listPullRequestFiles(ctx, client, owner, repo, prNumber)
+	if fetchErr != nil {
+		return fmt.Errorf("error re-fetching PR files: %w (after %v)", fetchErr, err)
+	}
+
+	logDiffChanges(files, current)
+	remapped := remapComments(comments, files, current)
+	logf(slog.LevelInfo, "Retrying with %d of %d comments re-mapped to the current diff.\n", len(remapped), len(comments))
+
+	return postReviewWithComments(client, ctx, owner, repo, prNumber, review, positionComments(remapped, current), state, opts)
+}
+
+// logDiffChanges logs the files added, removed or changed between two fetches of the PR's files
+func logDiffChanges(before, after []*github.CommitFile) {
+	patches := make(map[string]string)
+	for _, file := range before {
+		patches[file.GetFilename()] = file.GetPatch()
+	}
+	for _, file := range after {
+		old, ok := patches[file.GetFilename()]
+		switch {
+		case !ok:
+			logf(slog.LevelDebug, "File %s was added to the PR since it was fetched.\n", file.GetFilename())
+		case old != file.GetPatch():
+			logf(slog.LevelDebug, "File %s changed since it was fetched.\n", file.GetFilename())
+		}
+		delete(patches, file.GetFilename())
+	}
+	for filename := range patches {
+		logf(slog.LevelDebug, "File %s is no longer part of the PR.\n", filename)
+	}
+}
+
+// remapComments moves each comment to the line of the current diff holding the code it was made on,
+// the nearest one when the code appears several times. Comments whose code is gone are dropped.
+func remapComments(comments []*github.DraftReviewComment, before, after []*github.CommitFile) []*github.DraftReviewComment {
+	oldLines := make(map[string]map[int]string)
+	oldRemoved := make(map[string]map[int]string)
+	for _, file := range before {
+		oldLines[file.GetFilename()] = commentableLines(file.GetPatch())
+		oldRemoved[file.GetFilename()] = removedLines(file.GetPatch())
+	}
+	newLines := make(map[string]map[int]string)
+	newRemoved := make(map[string]map[int]string)
+	for _, file := range after {
+		if file.Patch != nil {
+			newLines[file.GetFilename()] = commentableLines(file.GetPatch())
+			newRemoved[file.GetFilename()] = removedLines(file.GetPatch())
+		}
+	}
+
+	var remapped []*github.DraftReviewComment
+	for _, comment := range comments {
+		path, line := comment.GetPath(), comment.GetLine()
+		content, known := oldLines[path][line]
+		current, inDiff := newLines[path]
+		if comment.GetSide() == "LEFT" {
+			// the old file is the base, its line numbers don't move
+			content, known = oldRemoved[path][line]
+			current, inDiff = newRemoved[path]
+		}
+		if !known || !inDiff {
+			logf(slog.LevelWarn, "Dropping comment on %s:%d, the line is no longer part of the diff.\n", path, line)
+			continue
+		}
+
+		target := 0
+		for candidate, text := range current {
+			if text != content {
+				continue
+			}
+			if target == 0 || abs(candidate-line) < abs(target-line) {
+				target = candidate
+			}
+		}
+		if target == 0 {
+			logf(slog.LevelWarn, "Dropping comment on %s:%d, the commented code was changed.\n", path, line)
+			continue
+		}
+		if target != line {
+			logf(slog.LevelDebug, "Moving comment on %s:%d to line %d.\n", path, line, target)
+		}
+
+		c := *comment
+		c.Line = github.Int(target)
+		if comment.StartLine != nil {
+			// ranges move as a whole, and become single-line comments when their start left the diff
+			start := comment.GetStartLine() + target - line
+			if _, ok := current[start]; ok {
+				c.StartLine = github.Int(start)
+			} else {
+				c.StartLine, c.StartSide = nil, nil
+			}
+		}
+		remapped = append(remapped, &c)
+	}
+	return remapped
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
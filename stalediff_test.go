@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+)
+
+func TestIsInvalidPositionError(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   bool
+	}{
+		{422, `{"message":"Unprocessable Entity","errors":["Line could not be resolved"]}`, true},
+		{422, `{"message":"Unprocessable Entity","errors":["Path could not be resolved"]}`, true},
+		{422, `{"message":"Unprocessable Entity","errors":["pull_request_review_thread.line must be part of the diff"]}`, true},
+		{422, `{"message":"Unprocessable Entity","errors":["pull_request_review_thread.start_line must be part of the same hunk as the line."]}`, true},
+		{422, `{"message":"Unprocessable Entity","errors":["User can only have one pending review per pull request"]}`, false},
+		{422, `{"message":"Validation Failed","errors":[{"resource":"PullRequestReview","field":"body","code":"custom","message":"The position of the body is too long"}]}`, false},
+		{404, `{"message":"Not Found"}`, false},
+	}
+	for _, test := range tests {
+		client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.body)
+		}))
+		_, _, err := client.PullRequests.CreateReview(context.Background(), "octocat", "hello", 7, &github.PullRequestReviewRequest{})
+		if got := isInvalidPositionError(err); got != test.want {
+			t.Errorf("isInvalidPositionError(%s) = %v, want %v", test.body, got, test.want)
+		}
+	}
+}
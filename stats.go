@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// statsHeader is the header row of the -stats-db CSV file
+var statsHeader = []string{"timestamp", "repo", "pr", "sha", "action", "comments", "tokens", "cost", "posted"}
+
+// appendStats appends a row per reviewed PR to the stats CSV file, creating it with a header when missing
+func appendStats(path string, outcomes []*reviewOutcome) error {
+	info, err := os.Stat(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	empty := err != nil || info.Size() == 0
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if empty {
+		w.Write(statsHeader)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, outcome := range outcomes {
+		action := outcome.State
+		if outcome.Err != nil {
+			action = "ERROR"
+		}
+		w.Write([]string{
+			now,
+			outcome.Owner + "/" + outcome.Repo,
+			strconv.Itoa(outcome.Number),
+			outcome.HeadSHA,
+			action,
+			strconv.Itoa(outcome.Comments),
+			strconv.Itoa(outcome.Usage.TotalTokens),
+			strconv.FormatFloat(outcome.Cost, 'f', 6, 64),
+			strconv.FormatBool(outcome.Posted),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// weekStats aggregates the reviews of one ISO week
+type weekStats struct {
+	Reviews  int
+	Approved int
+	Blocked  int
+	Cost     float64
+}
+
+// printStatsReport prints the reviews per week, the approve/block ratio and the total cost recorded in the stats CSV file
+func printStatsReport(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	weeks := make(map[string]*weekStats)
+	var total weekStats
+	for i, record := range records {
+		if i == 0 && record[0] == statsHeader[0] {
+			continue
+		}
+		if len(record) < len(statsHeader) {
+			return fmt.Errorf("line %d of %s has %d fields, expected %d", i+1, path, len(record), len(statsHeader))
+		}
+		timestamp, err := time.Parse(time.RFC3339, record[0])
+		if err != nil {
+			return fmt.Errorf("invalid timestamp on line %d of %s: %w", i+1, path, err)
+		}
+		cost, _ := strconv.ParseFloat(record[7], 64)
+
+		year, week := timestamp.ISOWeek()
+		key := fmt.Sprintf("%d-W%02d", year, week)
+		if weeks[key] == nil {
+			weeks[key] = &weekStats{}
+		}
+		for _, s := range []*weekStats{weeks[key], &total} {
+			s.Reviews++
+			s.Cost += cost
+			switch record[4] {
+			case "APPROVE":
+				s.Approved++
+			case "REQUEST_CHANGES":
+				s.Blocked++
+			}
+		}
+	}
+
+	var keys []string
+	for key := range weeks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "%-10s %8s %8s %8s %10s\n", "Week", "Reviews", "Approved", "Blocked", "Cost")
+	for _, key := range keys {
+		s := weeks[key]
+		fmt.Fprintf(w, "%-10s %8d %8d %8d %10s\n", key, s.Reviews, s.Approved, s.Blocked, fmt.Sprintf("$%.4f", s.Cost))
+	}
+	fmt.Fprintf(w, "\nTotal reviews: %d\n", total.Reviews)
+	if total.Approved+total.Blocked > 0 {
+		fmt.Fprintf(w, "Approve/block ratio: %d/%d (%.0f%% approved)\n", total.Approved, total.Blocked,
+			100*float64(total.Approved)/float64(total.Approved+total.Blocked))
+	}
+	fmt.Fprintf(w, "Total cost: $%.4f\n", total.Cost)
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import "strings"
+
+// suggestionSentinel ends a suggestion block following a comment of the "Specific Comments" section,
+// so a block isn't cut short when the model forgets or misplaces the closing fence
+const suggestionSentinel = "END_SUGGESTION"
+
+// suggestionBlock reads the suggestion block starting the lines, if any: from the ```suggestion fence to the
+// sentinel, or to the last closing fence before the next comment when the sentinel is missing. It returns
+// the block, with the indentation of its opening fence removed, and how many lines it took (0 when there
+// is no block). A block that doesn't close is dropped.
+func suggestionBlock(lines []string) (string, int) {
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	if start == len(lines) || !strings.HasPrefix(strings.TrimSpace(lines[start]), "```suggestion") {
+		return "", 0
+	}
+	indent := len(lines[start]) - len(strings.TrimLeft(lines[start], " \t"))
+
+	closing := -1
+	for i := start + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == suggestionSentinel {
+			if closing == -1 {
+				return "", i + 1
+			}
+			return dedentBlock(lines[start:closing+1], indent), i + 1
+		}
+		if specificCommentRe.MatchString(trimmed) {
+			break
+		}
+		if trimmed == "```" {
+			closing = i
+		}
+	}
+	if closing == -1 {
+		return "", 0
+	}
+	return dedentBlock(lines[start:closing+1], indent), closing + 1
+}
+
+// dedentBlock removes up to indent leading whitespace characters from every line of the block
+func dedentBlock(lines []string, indent int) string {
+	var out []string
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		cut := 0
+		for cut < indent && cut < len(line) && (line[cut] == ' ' || line[cut] == '\t') {
+			cut++
+		}
+		out = append(out, line[cut:])
+	}
+	return strings.Join(out, "\n")
+}
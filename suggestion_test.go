@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSuggestionBlock(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantBlock string
+		wantLines int
+	}{
+		{
+			name:      "sentinel",
+			input:     "```suggestion\n\ttimeout := defaultTimeout\n```\nEND_SUGGESTION\n- File: \"b.go\", Line 3: \"[nit] Typo\"",
+			wantBlock: "```suggestion\n\ttimeout := defaultTimeout\n```",
+			wantLines: 4,
+		},
+		{
+			name:      "fence inside the block",
+			input:     "```suggestion\n// Example:\n// ```\n// run()\n// ```\n```\nEND_SUGGESTION",
+			wantBlock: "```suggestion\n// Example:\n// ```\n// run()\n// ```\n```",
+			wantLines: 7,
+		},
+		{
+			name:      "indented, after a blank line",
+			input:     "\n  ```suggestion\n    return nil\n  ```\n  END_SUGGESTION",
+			wantBlock: "```suggestion\n  return nil\n```",
+			wantLines: 5,
+		},
+		{
+			name:      "missing sentinel",
+			input:     "```suggestion\nreturn err\n```\nMore text.\n- File: \"b.go\", Line 3: \"[nit] Typo\"",
+			wantBlock: "```suggestion\nreturn err\n```",
+			wantLines: 3,
+		},
+		{
+			name:      "missing sentinel, last closing fence wins",
+			input:     "```suggestion\nx := 1\n```\ny := 2\n```",
+			wantBlock: "```suggestion\nx := 1\n```\ny := 2\n```",
+			wantLines: 5,
+		},
+		{
+			name:      "never closed",
+			input:     "```suggestion\nreturn err\n- File: \"b.go\", Line 3: \"[nit] Typo\"",
+			wantLines: 0,
+		},
+		{
+			name:      "sentinel without a closing fence",
+			input:     "```suggestion\nreturn err\nEND_SUGGESTION",
+			wantLines: 3,
+		},
+		{
+			name:      "no block",
+			input:     "- File: \"b.go\", Line 3: \"[nit] Typo\"",
+			wantLines: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, lines := suggestionBlock(strings.Split(tt.input, "\n"))
+			if block != tt.wantBlock || lines != tt.wantLines {
+				t.Errorf("suggestionBlock(%q) = %q, %d, want %q, %d", tt.input, block, lines, tt.wantBlock, tt.wantLines)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// sweepProgress records the PRs a sweep has completed, so an interrupted sweep can be resumed
+type sweepProgress struct {
+	Owner string `json:"owner"`
+	Repo  string `json:"repo"`
+	// Completed maps the completed PR numbers to the head SHA they were reviewed at
+	Completed map[int]string `json:"completed"`
+	// Dir is the reviews directory the progress file is kept in
+	Dir string `json:"-"`
+}
+
+// sweepProgressPath returns the path of the progress file of the repository's sweep
+func sweepProgressPath(dir, owner, repo string) string {
+	return filepath.Join(dir, fmt.Sprintf("sweep-%s-%s.json", owner, repo))
+}
+
+// loadSweepProgress reads the progress of an earlier sweep from the reviews directory, or returns
+// an empty one when there is none
+func loadSweepProgress(dir, owner, repo string) (*sweepProgress, error) {
+	progress := &sweepProgress{Owner: owner, Repo: repo, Completed: make(map[int]string), Dir: dir}
+	data, err := os.ReadFile(sweepProgressPath(dir, owner, repo))
+	if errors.Is(err, os.ErrNotExist) {
+		return progress, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, progress); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", sweepProgressPath(dir, owner, repo), err)
+	}
+	if progress.Completed == nil {
+		progress.Completed = make(map[int]string)
+	}
+	progress.Dir = dir
+	return progress, nil
+}
+
+// save writes the progress to disk, it is called after every PR so a crash loses at most one review
+func (p *sweepProgress) save() error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := sweepProgressPath(p.Dir, p.Owner, p.Repo)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// remove deletes the progress file once the sweep has completed
+func (p *sweepProgress) remove() error {
+	err := os.Remove(sweepProgressPath(p.Dir, p.Owner, p.Repo))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// reviewedAtHead reports whether the tool already posted a review of the PR's current head commit
+func reviewedAtHead(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest) (bool, error) {
+	reviews, err := listReviews(client, ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return false, err
+	}
+	for _, review := range reviews {
+		if review.GetState() != "PENDING" && review.GetCommitID() == pr.GetHead().GetSHA() && strings.Contains(review.GetBody(), commentMarker) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/google/go-github/v55/github"
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultTestFastPathModel is the cheaper model reviewing PRs that only change tests
+const defaultTestFastPathModel = openai.GPT4oMini
+
+// generalReviewSections are the sections the model is asked for in a regular review
+const generalReviewSections = `Summary of What the PR Does: (prettyfy this section)
+
+Suggestions for Improvements or Refactoring: (prettyfy this section)
+
+Potential Bugs or Issues to Look Out For: (prettyfy this section)`
+
+// testReviewSections replace generalReviewSections when the PR only changes tests
+const testReviewSections = `This PR only changes tests. Focus the review on the quality of the tests rather than on general code review.
+
+Summary of What the PR Does: (prettyfy this section)
+
+Test Quality: (prettyfy this section) Do the tests assert meaningful behavior, cover edge cases and failure paths, and stay isolated and deterministic (no sleeps, shared state, network or clock dependencies making them flaky)?
+
+Missing Test Cases: (prettyfy this section)`
+
+// testFastPathNote is added to the summary of the reviews that took the test-only fast path
+const testFastPathNote = "> 🧪 This PR only changes tests, so it got a lighter test-only fast-path review focused on test quality."
+
+// onlyTestFiles reports whether every changed file is a test file
+func onlyTestFiles(files []*github.CommitFile) bool {
+	if len(files) == 0 {
+		return false
+	}
+	for _, file := range files {
+		if !isTestFile(file.GetFilename()) {
+			return false
+		}
+	}
+	return true
+}
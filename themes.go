@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// themeSimilarity is the minimum word overlap (Jaccard index) for two comments to share a theme
+const themeSimilarity = 0.5
+
+// themeWordRe matches the words used to compare comments
+var themeWordRe = regexp.MustCompile(`[a-z][a-z0-9_.]{2,}`)
+
+// themeStopWords are too common to say anything about a comment's theme
+var themeStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "this": true, "that": true, "with": true, "should": true,
+	"could": true, "would": true, "not": true, "are": true, "was": true, "can": true, "may": true,
+	"here": true, "which": true, "from": true, "have": true, "has": true, "consider": true,
+}
+
+// themeWords returns the significant words of a comment, ignoring its severity tag
+func themeWords(body string) map[string]bool {
+	words := make(map[string]bool)
+	body = strings.ToLower(severityTagRe.ReplaceAllString(body, ""))
+	for _, word := range themeWordRe.FindAllString(body, -1) {
+		if !themeStopWords[word] {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+// similarity returns the Jaccard index of two word sets
+func similarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// groupThemes collapses groups of at least minCount similar comments into a single bullet of a
+// "Recurring Issues" section. It returns the comments left inline and the section, "" when no
+// theme recurs often enough.
+func groupThemes(pr *github.PullRequest, comments []*github.DraftReviewComment, minCount int) ([]*github.DraftReviewComment, string) {
+	type theme struct {
+		words    map[string]bool
+		comments []*github.DraftReviewComment
+	}
+
+	// greedily assign each comment to the first theme it resembles
+	var themes []*theme
+	for _, comment := range comments {
+		words := themeWords(comment.GetBody())
+		var match *theme
+		for _, t := range themes {
+			if similarity(words, t.words) >= themeSimilarity {
+				match = t
+				break
+			}
+		}
+		if match == nil {
+			match = &theme{words: words}
+			themes = append(themes, match)
+		}
+		match.comments = append(match.comments, comment)
+	}
+
+	var inline []*github.DraftReviewComment
+	lines := []string{"### Recurring Issues"}
+	for _, t := range themes {
+		if len(t.comments) < minCount {
+			inline = append(inline, t.comments...)
+			continue
+		}
+		var locations []string
+		for _, comment := range t.comments {
+			location := fmt.Sprintf("%s:%d", comment.GetPath(), comment.GetLine())
+			locations = append(locations, fmt.Sprintf("[%s](%s)", location, commentLink(pr, comment)))
+		}
+		lines = append(lines, fmt.Sprintf("- %s (%d locations): %s", t.comments[0].GetBody(), len(t.comments), strings.Join(locations, ", ")))
+	}
+
+	if len(lines) == 1 {
+		return comments, ""
+	}
+	return inline, strings.Join(lines, "\n")
+}
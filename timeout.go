@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// defaultRunTimeout is the default -timeout of a whole run: none, as a sweep of many PRs legitimately takes
+// long. CI jobs set one so a hung GitHub or model call can't block them forever.
+const defaultRunTimeout time.Duration = 0
+
+// runTimedOut reports whether the run's -timeout expired, as opposed to a shorter deadline such as -review-timeout
+func runTimedOut(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// exitOnRunTimeout exits with status 1 naming the phase cut short when err is due to the run's -timeout,
+// and does nothing otherwise
+func exitOnRunTimeout(ctx context.Context, timeout time.Duration, phase string, err error) {
+	if err == nil || !runTimedOut(ctx) {
+		return
+	}
+	fmt.Printf("Error: the run timed out after %s while %s: %v\n", timeout, phase, err)
+	os.Exit(1)
+}
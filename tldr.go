@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// generateTLDR asks the model for a short executive summary of a finished review.
+// It is a separate call so it can't disturb the parsing of the comments and the recommendation.
+func generateTLDR(ctx context.Context, completion completionOptions, review string, state string) (string, error) {
+	prompt := fmt.Sprintf(`
+	The following is a code review of a pull request. Write a TL;DR of it for a busy maintainer: 2 to 3 sentences covering what the PR does, the most important problems found, if any, and whether it is ready to merge. Answer with the TL;DR only, as plain text without headings or lists.
+
+	Verdict: %s
+
+	Review:
+	%s
+	`, state, review)
+
+	resp, err := createCompletion(ctx, completion, prompt)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(resp.Choices[0].Message.Content), " "), nil
+}
+
+// prependTLDR puts the TL;DR above the review, separated from the detailed sections
+func prependTLDR(review, tldr string) string {
+	return fmt.Sprintf("**TL;DR:** %s\n\n---\n\n%s", tldr, review)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// tokenizerWait is how long a token count waits for a tokenizer still downloading before estimating
+const tokenizerWait = 10 * time.Second
+
+// tokenizerRetryInterval is how long a failed tokenizer download is remembered before being retried
+const tokenizerRetryInterval = time.Minute
+
+// encoderLoad is the tokenizer of a model, downloaded in the background. done is closed once it's loaded.
+type encoderLoad struct {
+	done    chan struct{}
+	encoder *tiktoken.Tiktoken
+	// failed is when the download failed, the zero time while it's in progress or when it succeeded
+	failed time.Time
+	// slow is set once a count gave up waiting for the download, the next ones don't wait
+	slow bool
+}
+
+// encoders holds the tokenizer loads of the models, nil for the models without a known encoding
+var (
+	encodersMu sync.Mutex
+	encoders   = make(map[string]*encoderLoad)
+)
+
+// contextWindows lists the context window of the known models, matched by the longest model name prefix
+var contextWindows = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4-turbo":   128000,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"claude-3":      200000,
+}
+
+// encoderFor returns the tokenizer of the model, or nil when it isn't available yet or has no known encoding.
+// The encodings are downloaded on first use (and cached in TIKTOKEN_CACHE_DIR when set) without holding
+// up the counts: they wait for the download until ctx is done or for tokenizerWait at most, and a failed
+// download is retried after tokenizerRetryInterval.
+func encoderFor(ctx context.Context, model string) *tiktoken.Tiktoken {
+	encodersMu.Lock()
+	load, ok := encoders[model]
+	if ok && load != nil && !load.failed.IsZero() && time.Since(load.failed) > tokenizerRetryInterval {
+		ok = false
+	}
+	if !ok {
+		load = startEncoderLoad(model)
+		encoders[model] = load
+	}
+	encodersMu.Unlock()
+	if load == nil {
+		return nil
+	}
+
+	select {
+	case <-load.done:
+		return load.encoder
+	default:
+	}
+	encodersMu.Lock()
+	slow := load.slow
+	encodersMu.Unlock()
+	if slow {
+		return nil
+	}
+
+	wait := time.NewTimer(tokenizerWait)
+	defer wait.Stop()
+	select {
+	case <-load.done:
+		return load.encoder
+	case <-ctx.Done():
+	case <-wait.C:
+	}
+	encodersMu.Lock()
+	load.slow = true
+	encodersMu.Unlock()
+	logf(slog.LevelInfo, "The tokenizer of %s is still downloading, estimating token counts meanwhile\n", model)
+	return nil
+}
+
+// startEncoderLoad starts downloading the tokenizer of the model, it returns nil when the model has no known encoding
+func startEncoderLoad(model string) *encoderLoad {
+	if !hasEncoding(model) {
+		logf(slog.LevelInfo, "No tokenizer for %s, estimating token counts\n", model)
+		return nil
+	}
+	load := &encoderLoad{done: make(chan struct{})}
+	go func() {
+		encoder, err := tiktoken.EncodingForModel(model)
+		encodersMu.Lock()
+		if err != nil {
+			logf(slog.LevelError, "Error loading the tokenizer of %s, estimating token counts: %v\n", model, err)
+			load.failed = time.Now()
+		}
+		load.encoder = encoder
+		encodersMu.Unlock()
+		close(load.done)
+	}()
+	return load
+}
+
+// hasEncoding reports whether tiktoken knows the encoding of the model
+func hasEncoding(model string) bool {
+	if _, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return true
+	}
+	for prefix := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// countTokens returns the number of tokens of the text for the model. Models without a known
+// encoding (e.g. Claude) fall back to the rough 4 characters per token heuristic, and so do
+// the counts made while the model's tokenizer is unavailable.
+func countTokens(ctx context.Context, model, text string) int {
+	if encoder := encoderFor(ctx, model); encoder != nil {
+		return len(encoder.EncodeOrdinary(text))
+	}
+	return (len(text) + 3) / 4
+}
+
+// contextWindow returns the context window of the model in tokens, or 0 when unknown
+func contextWindow(model string) int {
+	window := 0
+	matched := ""
+	for name, size := range contextWindows {
+		if strings.HasPrefix(model, name) && len(name) > len(matched) {
+			matched, window = name, size
+		}
+	}
+	return window
+}
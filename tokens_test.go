@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// stubBpeLoader stands in for the download of the encodings, failing once release is closed
+type stubBpeLoader struct {
+	calls   atomic.Int32
+	mu      sync.Mutex
+	release chan struct{}
+}
+
+func (l *stubBpeLoader) LoadTiktokenBpe(file string) (map[string]int, error) {
+	l.calls.Add(1)
+	l.mu.Lock()
+	release := l.release
+	l.mu.Unlock()
+	if release != nil {
+		<-release
+	}
+	return nil, errors.New("offline")
+}
+
+// testBpeLoader replaces the download of the encodings for every test, tiktoken doesn't allow
+// swapping the loader while an encoding may be loading
+var (
+	testBpeLoader     = &stubBpeLoader{}
+	testBpeLoaderOnce sync.Once
+)
+
+// withStubBpeLoader resets the stub download, blocking it until release is closed when not nil,
+// and forgets the loaded tokenizers
+func withStubBpeLoader(release chan struct{}) *stubBpeLoader {
+	testBpeLoaderOnce.Do(func() { tiktoken.SetBpeLoader(testBpeLoader) })
+	testBpeLoader.calls.Store(0)
+	testBpeLoader.mu.Lock()
+	testBpeLoader.release = release
+	testBpeLoader.mu.Unlock()
+	encodersMu.Lock()
+	encoders = make(map[string]*encoderLoad)
+	encodersMu.Unlock()
+	return testBpeLoader
+}
+
+func TestCountTokensDoesNotWaitPastContext(t *testing.T) {
+	release := make(chan struct{})
+	withStubBpeLoader(release)
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if got := countTokens(ctx, "gpt-4o", "12345678"); got != 2 {
+		t.Errorf("got %d tokens, want the estimate of 2", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the count took %s, want it to give up with the context", elapsed)
+	}
+
+	// the next counts don't wait for the same download
+	start = time.Now()
+	countTokens(context.Background(), "gpt-4o", "12345678")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the second count took %s, want it not to wait", elapsed)
+	}
+}
+
+func TestCountTokensRetriesFailedDownloads(t *testing.T) {
+	loader := withStubBpeLoader(nil)
+
+	if got := countTokens(context.Background(), "gpt-4-0613", "12345678"); got != 2 {
+		t.Errorf("got %d tokens, want the estimate of 2", got)
+	}
+	countTokens(context.Background(), "gpt-4-0613", "12345678")
+	if calls := loader.calls.Load(); calls != 1 {
+		t.Fatalf("the encoding was downloaded %d times, want a single attempt within the retry interval", calls)
+	}
+
+	encodersMu.Lock()
+	encoders["gpt-4-0613"].failed = time.Now().Add(-2 * tokenizerRetryInterval)
+	encodersMu.Unlock()
+	countTokens(context.Background(), "gpt-4-0613", "12345678")
+	if calls := loader.calls.Load(); calls != 2 {
+		t.Errorf("the encoding was downloaded %d times, want a retry after the interval", calls)
+	}
+}
+
+func TestCountTokensEstimatesUnknownModels(t *testing.T) {
+	loader := withStubBpeLoader(nil)
+
+	if got := countTokens(context.Background(), "claude-3-5-sonnet", "123456789"); got != 3 {
+		t.Errorf("got %d tokens, want the estimate of 3", got)
+	}
+	if calls := loader.calls.Load(); calls != 0 {
+		t.Errorf("the encoding was downloaded %d times for a model without one", calls)
+	}
+}
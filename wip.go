@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// defaultWIPPrefixes are the title prefixes marking a PR as work in progress
+const defaultWIPPrefixes = "WIP,[WIP],Draft:"
+
+// isWorkInProgress reports whether the PR is a draft or its title starts with one of the WIP prefixes (case-insensitive).
+// A prefix ending in a letter or a digit must be followed by a separator, so "WIP: fix" matches but "Wipe the cache" doesn't.
+func isWorkInProgress(pr *github.PullRequest, prefixes []string) bool {
+	if pr.GetDraft() {
+		return true
+	}
+	title := strings.ToLower(strings.TrimSpace(pr.GetTitle()))
+	for _, prefix := range prefixes {
+		prefix = strings.ToLower(prefix)
+		if prefix == "" || !strings.HasPrefix(title, prefix) {
+			continue
+		}
+		last, _ := utf8.DecodeLastRuneInString(prefix)
+		next, _ := utf8.DecodeRuneInString(title[len(prefix):])
+		if isWordRune(last) && isWordRune(next) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// isWordRune reports whether the rune is part of a word, utf8.RuneError (the end of the title) isn't
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
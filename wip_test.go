@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+)
+
+func TestIsWorkInProgress(t *testing.T) {
+	prefixes := strings.Split(defaultWIPPrefixes, ",")
+	tests := []struct {
+		title string
+		want  bool
+	}{
+		{"WIP: add the cache", true},
+		{"wip add the cache", true},
+		{"WIP", true},
+		{"[WIP] add the cache", true},
+		{"[wip]add the cache", true},
+		{"Draft: add the cache", true},
+		{"Wipe the cache on logout", false},
+		{"WIPO compliance", false},
+		{"Drafting rules", false},
+		{"Add the cache", false},
+	}
+	for _, test := range tests {
+		pr := &github.PullRequest{Title: github.String(test.title)}
+		if got := isWorkInProgress(pr, prefixes); got != test.want {
+			t.Errorf("isWorkInProgress(%q) = %v, want %v", test.title, got, test.want)
+		}
+	}
+	if !isWorkInProgress(&github.PullRequest{Title: github.String("Add the cache"), Draft: github.Bool(true)}, prefixes) {
+		t.Errorf("a draft PR isn't work in progress")
+	}
+}